@@ -3,6 +3,8 @@ package actor
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
+	"io"
 
 	"github.com/howood/imagereductor/domain/entity"
 	"github.com/howood/imagereductor/domain/repository"
@@ -45,6 +47,16 @@ func (e *cachedContentCreator) GetContent() []byte {
 	return e.chachedData.Content
 }
 
+// SetHeaders sets response headers of cached content.
+func (e *cachedContentCreator) SetHeaders(headers map[string]string) {
+	e.chachedData.Headers = headers
+}
+
+// GetHeaders returns response headers of cached content.
+func (e *cachedContentCreator) GetHeaders() map[string]string {
+	return e.chachedData.Headers
+}
+
 // GobEncode serialized cached data to bytes.
 func (e *cachedContentCreator) GobEncode() ([]byte, error) {
 	w := new(bytes.Buffer)
@@ -59,6 +71,9 @@ func (e *cachedContentCreator) GobEncode() ([]byte, error) {
 	if err := encoder.Encode(e.chachedData.Content); err != nil {
 		return nil, err
 	}
+	if err := encoder.Encode(e.chachedData.Headers); err != nil {
+		return nil, err
+	}
 	return w.Bytes(), nil
 }
 
@@ -76,5 +91,9 @@ func (e *cachedContentCreator) GobDecode(buf []byte) error {
 	if err := decoder.Decode(&e.chachedData.Content); err != nil {
 		return err
 	}
+	// headers are missing in cache written by older versions
+	if err := decoder.Decode(&e.chachedData.Headers); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
 	return nil
 }
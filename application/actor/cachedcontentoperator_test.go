@@ -93,3 +93,44 @@ func Test_CachedContentOperator_GobDecode_PartialLastModified(t *testing.T) {
 		t.Fatal("expected error decoding partial gob (missing Content), got nil")
 	}
 }
+
+func Test_CachedContentOperator_GobEncodeDecode_Headers(t *testing.T) {
+	t.Parallel()
+
+	src := actor.NewCachedContentOperator()
+	src.Set("image/png", "lastmodified-value", []byte("payload-bytes"))
+	src.SetHeaders(map[string]string{"X-Trim-Box": "1,2,3,4"})
+	encoded, err := src.GobEncode()
+	if err != nil {
+		t.Fatalf("GobEncode failed: %v", err)
+	}
+
+	dst := actor.NewCachedContentOperator()
+	if err := dst.GobDecode(encoded); err != nil {
+		t.Fatalf("GobDecode failed: %v", err)
+	}
+	if !reflect.DeepEqual(dst.GetHeaders(), map[string]string{"X-Trim-Box": "1,2,3,4"}) {
+		t.Fatalf("GetHeaders = %v, unexpected", dst.GetHeaders())
+	}
+}
+
+func Test_CachedContentOperator_GobDecode_WithoutHeaders(t *testing.T) {
+	t.Parallel()
+
+	// Encode entry cached before headers were stored
+	buf := new(bytes.Buffer)
+	encoder := gob.NewEncoder(buf)
+	for _, v := range []any{"image/png", "Mon, 01 Jan 2024 00:00:00 GMT", []byte("hello")} {
+		if err := encoder.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := actor.NewCachedContentOperator()
+	if err := dst.GobDecode(buf.Bytes()); err != nil {
+		t.Fatalf("GobDecode failed: %v", err)
+	}
+	if !reflect.DeepEqual(dst.GetContent(), []byte("hello")) || len(dst.GetHeaders()) != 0 {
+		t.Fatal("GobDecode returned mismatched data")
+	}
+}
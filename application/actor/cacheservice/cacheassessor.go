@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/howood/imagereductor/domain/entity"
 	"github.com/howood/imagereductor/infrastructure/client/caches"
 	log "github.com/howood/imagereductor/infrastructure/logger"
 	"github.com/howood/imagereductor/library/utils"
@@ -52,6 +54,27 @@ func NewCacheAssessorWithConfig(ctx context.Context, db int) (*CacheAssessor, er
 		return &CacheAssessor{
 			instance: caches.NewGoCacheClient(),
 		}, nil
+	case "memory":
+		return &CacheAssessor{
+			instance: caches.NewMemoryCache(GetMemoryCacheMaxBytes(), GetMemoryCacheMaxEntryBytes()),
+		}, nil
+	case "disk":
+		instance, err := caches.NewDiskCache(GetDiskCacheDir(), GetDiskCacheMaxBytes())
+		if err != nil {
+			return nil, err
+		}
+		return &CacheAssessor{
+			instance: instance,
+		}, nil
+	case "tiered":
+		return &CacheAssessor{
+			instance: caches.NewTieredCache(
+				caches.NewMemoryCache(GetL1CacheMaxBytes(), GetMemoryCacheMaxEntryBytes()),
+				//nolint:contextcheck
+				caches.NewRedis(true, db),
+				time.Duration(GetL1CacheExpired())*time.Second,
+			),
+		}, nil
 	default:
 		return nil, fmt.Errorf("%w: %s", ErrInvalidCacheType, cacheType)
 	}
@@ -85,6 +108,15 @@ func (ca *CacheAssessor) Set(ctx context.Context, index string, value any, expir
 	return ca.instance.Set(ctx, index, value, time.Duration(expired)*time.Second)
 }
 
+// Stats returns counters of cache when the cache instance counts them.
+func (ca *CacheAssessor) Stats() (entity.CacheStats, bool) {
+	instance, ok := ca.instance.(interface{ Stats() entity.CacheStats })
+	if !ok {
+		return entity.CacheStats{}, false
+	}
+	return instance.Stats(), true
+}
+
 // Delete remove cache contents.
 func (ca *CacheAssessor) Delete(ctx context.Context, index string) error {
 	defer func() {
@@ -101,6 +133,44 @@ func GetChacheExpired() int {
 	return utils.GetOsEnvInt("CACHEEXPIED", 300)
 }
 
+// GetL1CacheExpired get expired of L1 cache of tiered cache.
+func GetL1CacheExpired() int {
+	//nolint:mnd
+	return utils.GetOsEnvInt("L1CACHEEXPIRED", 60)
+}
+
+// GetL1CacheMaxBytes get total bytes budget of L1 cache of tiered cache.
+func GetL1CacheMaxBytes() int64 {
+	//nolint:mnd
+	return int64(utils.GetOsEnvInt("L1CACHEMAXBYTES", 67108864))
+}
+
+// GetMemoryCacheMaxBytes get total bytes budget of memory cache.
+func GetMemoryCacheMaxBytes() int64 {
+	//nolint:mnd
+	return int64(utils.GetOsEnvInt("MEMORYCACHEMAXBYTES", 268435456))
+}
+
+// GetMemoryCacheMaxEntryBytes get max bytes of an entry of memory cache.
+func GetMemoryCacheMaxEntryBytes() int64 {
+	//nolint:mnd
+	return int64(utils.GetOsEnvInt("MEMORYCACHEMAXENTRYBYTES", 10485760))
+}
+
+// GetDiskCacheDir get directory of disk cache.
+func GetDiskCacheDir() string {
+	if dir := os.Getenv("DISKCACHEDIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "imagereductor")
+}
+
+// GetDiskCacheMaxBytes get quota bytes of disk cache.
+func GetDiskCacheMaxBytes() int64 {
+	//nolint:mnd
+	return int64(utils.GetOsEnvInt("DISKCACHEMAXBYTES", 10737418240))
+}
+
 // GetCachedDB get cache db.
 func GetCachedDB() int {
 	return utils.GetOsEnvInt("CACHEDDB", 0)
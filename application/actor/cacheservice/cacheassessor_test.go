@@ -91,3 +91,59 @@ func Test_CacheAssessor_SetGetDelete_GoCache(t *testing.T) {
 		t.Fatal("expected cache miss after delete")
 	}
 }
+
+func Test_GetL1Cache_Default(t *testing.T) {
+	t.Setenv("L1CACHEEXPIRED", "")
+	t.Setenv("L1CACHEMAXBYTES", "")
+
+	if got := cacheservice.GetL1CacheExpired(); got != 60 {
+		t.Fatalf("GetL1CacheExpired default = %d, want 60", got)
+	}
+	if got := cacheservice.GetL1CacheMaxBytes(); got != 67108864 {
+		t.Fatalf("GetL1CacheMaxBytes default = %d, want 67108864", got)
+	}
+}
+
+func Test_NewCacheAssessorWithConfig_Memory(t *testing.T) {
+	t.Setenv("CACHE_TYPE", "memory")
+	assessor, err := cacheservice.NewCacheAssessorWithConfig(t.Context(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := assessor.Set(t.Context(), "key", []byte("value"), 60); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := assessor.Get(t.Context(), "key"); !found {
+		t.Fatal("expected cache hit")
+	}
+	stats, ok := assessor.Stats()
+	if !ok || stats.Hits != 1 || stats.Entries != 1 {
+		t.Fatalf("Stats = %+v, %v", stats, ok)
+	}
+}
+
+func Test_CacheAssessor_Stats_GoCache(t *testing.T) {
+	t.Setenv("CACHE_TYPE", "gocache")
+	assessor, err := cacheservice.NewCacheAssessorWithConfig(t.Context(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := assessor.Stats(); ok {
+		t.Fatal("gocache should not report stats")
+	}
+}
+
+func Test_NewCacheAssessorWithConfig_Disk(t *testing.T) {
+	t.Setenv("CACHE_TYPE", "disk")
+	t.Setenv("DISKCACHEDIR", t.TempDir())
+	assessor, err := cacheservice.NewCacheAssessorWithConfig(t.Context(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := assessor.Set(t.Context(), "key", []byte("value"), 60); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := assessor.Get(t.Context(), "key"); !found {
+		t.Fatal("expected cache hit")
+	}
+}
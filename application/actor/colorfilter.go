@@ -0,0 +1,144 @@
+package actor
+
+import (
+	"image"
+	"math"
+
+	"github.com/howood/imagereductor/library/utils"
+	"golang.org/x/image/draw"
+)
+
+// colorMatrix is 4x5 matrix of r,g,b,a rows. The last column is offset in 0.0 ~ 1.0.
+type colorMatrix [20]float64
+
+// identityColorMatrix keeps colors as they are.
+//
+//nolint:gochecknoglobals
+var identityColorMatrix = colorMatrix{
+	1, 0, 0, 0, 0,
+	0, 1, 0, 0, 0,
+	0, 0, 1, 0, 0,
+	0, 0, 0, 1, 0,
+}
+
+// then returns matrix applying m and n in that order.
+//
+//nolint:mnd
+func (m colorMatrix) then(n colorMatrix) colorMatrix {
+	var dst colorMatrix
+	for i := range 4 {
+		for j := range 5 {
+			var sum float64
+			for k := range 4 {
+				sum += n[i*5+k] * m[k*5+j]
+			}
+			if j == 4 {
+				sum += n[i*5+4]
+			}
+			dst[i*5+j] = sum
+		}
+	}
+	return dst
+}
+
+// colorFilterMatrix composes color filters in order of grayscale, sepia, saturation, hue rotate, invert and color matrix.
+// ok is false when no color filter is requested.
+//
+//nolint:mnd
+func (im *imageCreator) colorFilterMatrix() (colorMatrix, bool) {
+	matrix := identityColorMatrix
+	ok := false
+	if im.option.Grayscale {
+		matrix = matrix.then(saturationMatrix(0))
+		ok = true
+	}
+	if im.option.Sepia != 0 {
+		matrix = matrix.then(sepiaMatrix(utils.InRanged(float64(im.option.Sepia), 0, 100) / 100))
+		ok = true
+	}
+	if im.option.Saturation != 0 {
+		matrix = matrix.then(saturationMatrix((100 + utils.InRanged(float64(im.option.Saturation), -100, 500)) / 100))
+		ok = true
+	}
+	if im.option.HueRotate != 0 {
+		matrix = matrix.then(hueRotateMatrix(float64(im.option.HueRotate)))
+		ok = true
+	}
+	if im.option.Invert {
+		matrix = matrix.then(colorMatrix{
+			-1, 0, 0, 0, 1,
+			0, -1, 0, 0, 1,
+			0, 0, -1, 0, 1,
+			0, 0, 0, 1, 0,
+		})
+		ok = true
+	}
+	if im.option.ColorMatrix != [20]float64{} {
+		matrix = matrix.then(im.option.ColorMatrix)
+		ok = true
+	}
+	return matrix, ok
+}
+
+// saturationMatrix changes saturation by rate. 0 is grayscale and 1 keeps colors.
+//
+//nolint:mnd
+func saturationMatrix(rate float64) colorMatrix {
+	return colorMatrix{
+		0.213 + 0.787*rate, 0.715 - 0.715*rate, 0.072 - 0.072*rate, 0, 0,
+		0.213 - 0.213*rate, 0.715 + 0.285*rate, 0.072 - 0.072*rate, 0, 0,
+		0.213 - 0.213*rate, 0.715 - 0.715*rate, 0.072 + 0.928*rate, 0, 0,
+		0, 0, 0, 1, 0,
+	}
+}
+
+// sepiaMatrix tones sepia by amount of 0.0 ~ 1.0.
+//
+//nolint:mnd
+func sepiaMatrix(amount float64) colorMatrix {
+	rest := 1 - amount
+	return colorMatrix{
+		0.393 + 0.607*rest, 0.769 - 0.769*rest, 0.189 - 0.189*rest, 0, 0,
+		0.349 - 0.349*rest, 0.686 + 0.314*rest, 0.168 - 0.168*rest, 0, 0,
+		0.272 - 0.272*rest, 0.534 - 0.534*rest, 0.131 + 0.869*rest, 0, 0,
+		0, 0, 0, 1, 0,
+	}
+}
+
+// hueRotateMatrix rotates hue by degree keeping luminance.
+//
+//nolint:mnd
+func hueRotateMatrix(deg float64) colorMatrix {
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	return colorMatrix{
+		0.213 + cos*0.787 - sin*0.213, 0.715 - cos*0.715 - sin*0.715, 0.072 - cos*0.072 + sin*0.928, 0, 0,
+		0.213 - cos*0.213 + sin*0.143, 0.715 + cos*0.285 + sin*0.140, 0.072 - cos*0.072 - sin*0.283, 0, 0,
+		0.213 - cos*0.213 - sin*0.787, 0.715 - cos*0.715 + sin*0.715, 0.072 + cos*0.928 + sin*0.072, 0, 0,
+		0, 0, 0, 1, 0,
+	}
+}
+
+// convertColorMatrix applies color matrix to each pixel.
+//
+//nolint:mnd
+func (im *imageCreator) convertColorMatrix(src image.Image, matrix colorMatrix) *image.NRGBA {
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(bounds)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+	utils.ApplyParallel(0, dst.Bounds().Dy(), func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := range dst.Bounds().Dx() {
+				dstPos := y*dst.Stride + x*4
+				var c [4]float64
+				for i := range 4 {
+					c[i] = float64(dst.Pix[dstPos+i])
+				}
+				for i := range 4 {
+					v := matrix[i*5]*c[0] + matrix[i*5+1]*c[1] + matrix[i*5+2]*c[2] + matrix[i*5+3]*c[3] + matrix[i*5+4]*255
+					dst.Pix[dstPos+i] = uint8(utils.InRanged(math.Round(v), 0, 255))
+				}
+			}
+		}
+	})
+	return dst
+}
@@ -0,0 +1,211 @@
+package actor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"io"
+
+	log "github.com/howood/imagereductor/infrastructure/logger"
+	"golang.org/x/image/draw"
+)
+
+// ErrFrameOutOfRange is returned when frame option exceeds the number of frames.
+var ErrFrameOutOfRange = errors.New("frame out of range")
+
+// errGifBlock is returned when gif has an unknown block.
+var errGifBlock = errors.New("gif: unknown block")
+
+// decodeGifFrames decodes all frames of gif and selects source frames.
+// Animation is kept only when gif is output and no single frame is requested.
+func (im *imageCreator) decodeGifFrames(ctx context.Context, src io.Reader) error {
+	animation, err := gif.DecodeAll(src)
+	if err != nil {
+		return err
+	}
+	log.Debug(ctx, fmt.Sprintf("gif frames: %d / loop: %d", len(animation.Image), animation.LoopCount))
+	if im.option.Frame > len(animation.Image) {
+		return fmt.Errorf("%w: %d of %d", ErrFrameOutOfRange, im.option.Frame, len(animation.Image))
+	}
+	if len(animation.Image) < 2 && im.option.Frame == 0 {
+		im.object.Source = animation.Image[0]
+		return nil
+	}
+	if im.option.AutoFormat && im.option.Frame == 0 {
+		// animation is kept as gif, since negotiated format is encoded as a still image
+		im.option.Format = ImageFormatGif
+	}
+	frames := im.compositeGifFrames(animation)
+	switch {
+	case im.option.Frame > 0:
+		im.object.Source = frames[im.option.Frame-1]
+	case im.OutputContentType() == "image/gif":
+		im.object.Source = frames[0]
+		im.object.SourceFrames = frames
+		im.object.Animation = animation
+	default:
+		im.object.Source = frames[0]
+	}
+	return nil
+}
+
+// countGifFrames counts image descriptors of gif skipping its blocks without decoding pixels.
+//
+//nolint:mnd
+func countGifFrames(src io.Reader) (int, error) {
+	r := bufio.NewReader(src)
+	// header and logical screen descriptor
+	screen := make([]byte, 13)
+	if _, err := io.ReadFull(r, screen); err != nil {
+		return 0, err
+	}
+	if err := skipGifColorTable(r, screen[10]); err != nil {
+		return 0, err
+	}
+	frames := 0
+	for {
+		block, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch block {
+		case 0x21: // extension: label and sub-blocks
+			if _, err := r.ReadByte(); err != nil {
+				return 0, err
+			}
+		case 0x2c: // image descriptor: color table, LZW minimum code size and sub-blocks
+			frames++
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(r, descriptor); err != nil {
+				return 0, err
+			}
+			if err := skipGifColorTable(r, descriptor[8]); err != nil {
+				return 0, err
+			}
+			if _, err := r.ReadByte(); err != nil {
+				return 0, err
+			}
+		case 0x3b: // trailer
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("%w: 0x%02x", errGifBlock, block)
+		}
+		if err := skipGifSubBlocks(r); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// skipGifColorTable skips color table flagged by packed field of descriptor.
+//
+//nolint:mnd
+func skipGifColorTable(r *bufio.Reader, packed byte) error {
+	if packed&0x80 == 0 {
+		return nil
+	}
+	_, err := r.Discard(3 << (packed&0x07 + 1))
+	return err
+}
+
+// skipGifSubBlocks skips data sub-blocks until the block terminator.
+func skipGifSubBlocks(r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := r.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// compositeGifFrames renders each frame onto the full canvas following disposal methods.
+func (im *imageCreator) compositeGifFrames(animation *gif.GIF) []image.Image {
+	bounds := image.Rect(0, 0, animation.Config.Width, animation.Config.Height)
+	if bounds.Empty() {
+		for _, frame := range animation.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+	canvas := image.NewNRGBA(bounds)
+	frames := make([]image.Image, 0, len(animation.Image))
+	for i, frame := range animation.Image {
+		var disposal byte
+		if i < len(animation.Disposal) {
+			disposal = animation.Disposal[i]
+		}
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = im.cloneNRGBA(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames = append(frames, im.cloneNRGBA(canvas))
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+// processFrames runs the image process on each frame of animation.
+func (im *imageCreator) processFrames(ctx context.Context) error {
+	originX := im.object.OriginX
+	originY := im.object.OriginY
+	dstFrames := make([]image.Image, 0, len(im.object.SourceFrames))
+	for _, frame := range im.object.SourceFrames {
+		im.object.Source = frame
+		im.object.OriginX = originX
+		im.object.OriginY = originY
+		if err := im.processImage(ctx); err != nil {
+			return err
+		}
+		dstFrames = append(dstFrames, im.object.Dst)
+	}
+	im.object.DstFrames = dstFrames
+	return nil
+}
+
+// encodeGifAnimation encodes processed frames with delays, disposal and loop count of source.
+func (im *imageCreator) encodeGifAnimation(w io.Writer) error {
+	animation := &gif.GIF{
+		Image:     make([]*image.Paletted, 0, len(im.object.DstFrames)),
+		Delay:     im.object.Animation.Delay,
+		Disposal:  im.object.Animation.Disposal,
+		LoopCount: im.object.Animation.LoopCount,
+	}
+	for _, frame := range im.object.DstFrames {
+		animation.Image = append(animation.Image, im.paletted(frame))
+	}
+	return gif.EncodeAll(w, animation)
+}
+
+// paletted quantizes image to plan9 palette with a transparent color.
+//
+//nolint:mnd
+func (im *imageCreator) paletted(src image.Image) *image.Paletted {
+	pal := make(color.Palette, 0, 256)
+	pal = append(pal, palette.Plan9[:255]...)
+	pal = append(pal, color.Transparent)
+	bounds := src.Bounds()
+	dst := image.NewPaletted(bounds, pal)
+	draw.FloydSteinberg.Draw(dst, bounds, src, bounds.Min)
+	return dst
+}
+
+func (im *imageCreator) cloneNRGBA(src *image.NRGBA) *image.NRGBA {
+	dst := image.NewNRGBA(src.Bounds())
+	copy(dst.Pix, src.Pix)
+	return dst
+}
@@ -0,0 +1,216 @@
+package actor_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/howood/imagereductor/application/actor"
+)
+
+//nolint:gochecknoglobals
+var testGifFrameColors = []color.RGBA{
+	{R: 255, A: 255},
+	{G: 255, A: 255},
+	{B: 255, A: 255},
+}
+
+func newTestAnimatedGIFReader(t *testing.T, w, h int) *bytes.Reader {
+	t.Helper()
+	pal := color.Palette{color.Transparent}
+	for _, c := range testGifFrameColors {
+		pal = append(pal, c)
+	}
+	animation := &gif.GIF{
+		Delay:     []int{10, 20, 30},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		LoopCount: 2,
+	}
+	for i := range testGifFrameColors {
+		frame := image.NewPaletted(image.Rect(0, 0, w, h), pal)
+		for y := range h {
+			for x := range w {
+				frame.SetColorIndex(x, y, uint8(i+1))
+			}
+		}
+		animation.Image = append(animation.Image, frame)
+	}
+	buf := new(bytes.Buffer)
+	if err := gif.EncodeAll(buf, animation); err != nil {
+		t.Fatalf("gif.EncodeAll: %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func Test_ImageOperator_AnimatedGIF_Resize(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/gif", actor.ImageOperatorOption{Width: 20, Rotate: actor.ImageRotateRight, Brightness: 90})
+	if err := op.Decode(t.Context(), newTestAnimatedGIFReader(t, 40, 20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	out, err := op.ImageByte(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	animation, err := gif.DecodeAll(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if len(animation.Image) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(animation.Image))
+	}
+	if animation.LoopCount != 2 {
+		t.Fatalf("loop count = %d, want 2", animation.LoopCount)
+	}
+	for i, want := range []int{10, 20, 30} {
+		if animation.Delay[i] != want {
+			t.Fatalf("delay[%d] = %d, want %d", i, animation.Delay[i], want)
+		}
+	}
+	if animation.Disposal[1] != gif.DisposalBackground {
+		t.Fatalf("disposal[1] = %d, want background", animation.Disposal[1])
+	}
+	if b := animation.Image[2].Bounds(); b.Dx() != 20 || b.Dy() != 40 {
+		t.Fatalf("expected 20x40 frame, got %v", b)
+	}
+}
+
+func Test_ImageOperator_AnimatedGIF_AutoFormat(t *testing.T) {
+	t.Parallel()
+
+	option := actor.ImageOperatorOption{Width: 20, Format: actor.ImageFormatWebp, AutoFormat: true}
+	op := actor.NewImageOperator("image/gif", option)
+	if err := op.Decode(t.Context(), newTestAnimatedGIFReader(t, 40, 20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if got := op.OutputContentType(); got != "image/gif" {
+		t.Fatalf("OutputContentType = %q, want image/gif", got)
+	}
+	out, err := op.ImageByte(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	animation, err := gif.DecodeAll(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if len(animation.Image) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(animation.Image))
+	}
+}
+
+func Test_ImageOperator_AnimatedGIF_Frame(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/gif", actor.ImageOperatorOption{Frame: 2, Format: actor.ImageFormatPng})
+	if err := op.Decode(t.Context(), newTestAnimatedGIFReader(t, 10, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	out, err := op.ImageByte(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(out))
+	if err != nil || format != "png" {
+		t.Fatalf("expected png output, got %q (%v)", format, err)
+	}
+	if r, g, _, _ := img.At(5, 5).RGBA(); r != 0 || g != 0xffff {
+		t.Fatalf("expected green second frame, got %v", img.At(5, 5))
+	}
+}
+
+func Test_ImageOperator_AnimatedGIF_ToStill(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/gif", actor.ImageOperatorOption{Width: 5, Format: actor.ImageFormatPng})
+	if err := op.Decode(t.Context(), newTestAnimatedGIFReader(t, 10, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	out, err := op.ImageByte(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(out)); err != nil || format != "png" {
+		t.Fatalf("expected still png output, got %q (%v)", format, err)
+	}
+}
+
+func Test_ImageOperator_Frame_OutOfRange(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/gif", actor.ImageOperatorOption{Frame: 4})
+	if err := op.Decode(t.Context(), newTestAnimatedGIFReader(t, 10, 10)); !errors.Is(err, actor.ErrFrameOutOfRange) {
+		t.Fatalf("expected ErrFrameOutOfRange, got %v", err)
+	}
+	op = actor.NewImageOperator("image/png", actor.ImageOperatorOption{Frame: 2})
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 10, 10)); !errors.Is(err, actor.ErrFrameOutOfRange) {
+		t.Fatalf("expected ErrFrameOutOfRange for still image, got %v", err)
+	}
+}
+
+func Test_ImageOperator_Decode_GifScreenTooLarge(t *testing.T) {
+	t.Parallel()
+
+	pal := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{
+		Image:  []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 1, 1), pal), image.NewPaletted(image.Rect(0, 0, 1, 1), pal)},
+		Delay:  []int{10, 10},
+		Config: image.Config{ColorModel: pal, Width: 60000, Height: 60000},
+	}
+	buf := new(bytes.Buffer)
+	if err := gif.EncodeAll(buf, animation); err != nil {
+		t.Fatal(err)
+	}
+	op := actor.NewImageOperator("image/gif", actor.ImageOperatorOption{Width: 10})
+	if err := op.Decode(t.Context(), bytes.NewReader(buf.Bytes())); !errors.Is(err, actor.ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func Test_ImageOperator_Decode_GifFramesTooLarge(t *testing.T) {
+	t.Parallel()
+
+	pal := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{Config: image.Config{ColorModel: pal, Width: 3000, Height: 3000}}
+	for range 100 {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), pal))
+		animation.Delay = append(animation.Delay, 10)
+	}
+	buf := new(bytes.Buffer)
+	if err := gif.EncodeAll(buf, animation); err != nil {
+		t.Fatal(err)
+	}
+	op := actor.NewImageOperator("image/gif", actor.ImageOperatorOption{Width: 10})
+	if err := op.Decode(t.Context(), bytes.NewReader(buf.Bytes())); !errors.Is(err, actor.ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func Test_ImageOperator_Process_GifFramesOutputTooLarge(t *testing.T) {
+	t.Parallel()
+
+	// each frame of 6000x6000 is within the limit, but the animation of 3 frames is not
+	op := actor.NewImageOperator("image/gif", actor.ImageOperatorOption{Width: 6000, Height: 6000, Enlarge: true})
+	if err := op.Decode(t.Context(), newTestAnimatedGIFReader(t, 40, 40)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); !errors.Is(err, actor.ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+}
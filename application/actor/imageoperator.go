@@ -13,15 +13,21 @@ import (
 	"io"
 	"math"
 	"reflect"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/gen2brain/webp"
 	"github.com/howood/imagereductor/domain/entity"
 	"github.com/howood/imagereductor/domain/repository"
 	log "github.com/howood/imagereductor/infrastructure/logger"
 	"github.com/howood/imagereductor/library/utils"
 	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/image/bmp"
 	"golang.org/x/image/draw"
 	"golang.org/x/image/math/f64"
+	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp" // register webp decoder
 )
 
 const (
@@ -39,6 +45,134 @@ const (
 	ImageRotateExifOrientation = "exiforientation"
 )
 
+const (
+	// ImageFlipHorizontal is flip image horizontally.
+	ImageFlipHorizontal = "h"
+	// ImageFlipVertical is flip image vertically.
+	ImageFlipVertical = "v"
+	// ImageFlipBoth is flip image horizontally and vertically.
+	ImageFlipBoth = "hv"
+)
+
+// imageFlipList is list of flips.
+//
+//nolint:gochecknoglobals
+var imageFlipList = []string{ImageFlipHorizontal, ImageFlipVertical, ImageFlipBoth}
+
+// ImageRadiusMax is radius to make circle or pill shape.
+const ImageRadiusMax = "max"
+
+const (
+	// ImageFitInside is resize to fit inside width and height keeping aspect ratio.
+	ImageFitInside = "inside"
+	// ImageFitOutside is resize to cover width and height keeping aspect ratio.
+	ImageFitOutside = "outside"
+	// ImageFitCover is resize to cover width and height and crop the overflow.
+	ImageFitCover = "cover"
+	// ImageFitContain is resize to fit inside width and height and pad with background.
+	ImageFitContain = "contain"
+	// ImageFitPad is alias of ImageFitContain.
+	ImageFitPad = "pad"
+	// ImageFitFill is stretch to width and height ignoring aspect ratio.
+	ImageFitFill = "fill"
+)
+
+// imageFitList is list of fit modes.
+//
+//nolint:gochecknoglobals
+var imageFitList = []string{ImageFitInside, ImageFitOutside, ImageFitCover, ImageFitContain, ImageFitPad, ImageFitFill}
+
+const (
+	// ImageGravityCenter is crop anchored at center.
+	ImageGravityCenter = "center"
+	// ImageGravityNorth is crop anchored at top.
+	ImageGravityNorth = "n"
+	// ImageGravityNorthEast is crop anchored at top right.
+	ImageGravityNorthEast = "ne"
+	// ImageGravityEast is crop anchored at right.
+	ImageGravityEast = "e"
+	// ImageGravitySouthEast is crop anchored at bottom right.
+	ImageGravitySouthEast = "se"
+	// ImageGravitySouth is crop anchored at bottom.
+	ImageGravitySouth = "s"
+	// ImageGravitySouthWest is crop anchored at bottom left.
+	ImageGravitySouthWest = "sw"
+	// ImageGravityWest is crop anchored at left.
+	ImageGravityWest = "w"
+	// ImageGravityNorthWest is crop anchored at top left.
+	ImageGravityNorthWest = "nw"
+	// ImageGravityFocalPoint is crop centered on FocalPoint option.
+	ImageGravityFocalPoint = "focalpoint"
+	// ImageGravitySmart is crop the most salient region.
+	ImageGravitySmart = "smart"
+)
+
+// imageGravityList is list of gravities.
+//
+//nolint:gochecknoglobals
+var imageGravityList = []string{
+	ImageGravityCenter, ImageGravityNorth, ImageGravityNorthEast, ImageGravityEast, ImageGravitySouthEast,
+	ImageGravitySouth, ImageGravitySouthWest, ImageGravityWest, ImageGravityNorthWest, ImageGravityFocalPoint, ImageGravitySmart,
+}
+
+const (
+	// ImageFormatJpeg is output format of jpeg.
+	ImageFormatJpeg = "jpeg"
+	// ImageFormatPng is output format of png.
+	ImageFormatPng = "png"
+	// ImageFormatGif is output format of gif.
+	ImageFormatGif = "gif"
+	// ImageFormatWebp is output format of webp.
+	ImageFormatWebp = "webp"
+	// ImageFormatBmp is output format of bmp.
+	ImageFormatBmp = "bmp"
+	// ImageFormatTiff is output format of tiff.
+	ImageFormatTiff = "tiff"
+)
+
+const (
+	// ImageCompressionDeflate is deflate compression of tiff.
+	ImageCompressionDeflate = "deflate"
+	// ImageCompressionNone is no compression of tiff.
+	ImageCompressionNone = "none"
+)
+
+// imageCompressionList is list of tiff compressions.
+//
+//nolint:gochecknoglobals
+var imageCompressionList = []string{ImageCompressionDeflate, ImageCompressionNone}
+
+// imageOverlayPositionList is list of watermark and text positions.
+//
+//nolint:gochecknoglobals
+var imageOverlayPositionList = []string{
+	ImageGravityCenter, ImageGravityNorth, ImageGravityNorthEast, ImageGravityEast, ImageGravitySouthEast,
+	ImageGravitySouth, ImageGravitySouthWest, ImageGravityWest, ImageGravityNorthWest,
+}
+
+// imageFormatContentTypes is content types of output formats.
+//
+//nolint:gochecknoglobals
+var imageFormatContentTypes = map[string]string{
+	ImageFormatJpeg: "image/jpeg",
+	ImageFormatPng:  "image/png",
+	ImageFormatGif:  "image/gif",
+	ImageFormatWebp: "image/webp",
+	ImageFormatBmp:  "image/bmp",
+	ImageFormatTiff: "image/tiff",
+}
+
+const (
+	// maxBlurSigma is max sigma of gaussian blur to bound the kernel size.
+	maxBlurSigma = 50.0
+	// maxTextLength is max number of characters of text overlay.
+	maxTextLength = 256
+	// maxTrimThreshold is max color difference of trim.
+	maxTrimThreshold = 255
+	// maxDpr is max device pixel ratio.
+	maxDpr = 4
+)
+
 // ImageOperator struct.
 type ImageOperator struct {
 	repository.ImageObjectRepository
@@ -71,15 +205,65 @@ type subImager interface {
 	SubImage(r image.Rectangle) image.Image
 }
 
+type opaquer interface {
+	Opaque() bool
+}
+
+// IsSupportedImageFormat checks format is supported as output format.
+func IsSupportedImageFormat(format string) bool {
+	_, ok := imageFormatContentTypes[format]
+	return ok
+}
+
+// OutputContentType returns content type of converted image.
+func OutputContentType(contenttype string, option ImageOperatorOption) string {
+	if outputtype, ok := imageFormatContentTypes[option.Format]; ok {
+		return outputtype
+	}
+	return contenttype
+}
+
+// IsPassthroughOption checks option leaves image of content type as is,
+// so that original image is served without decoding and encoding it again.
+func IsPassthroughOption(contenttype string, option ImageOperatorOption) bool {
+	if option.AutoFormat && OutputContentType(contenttype, option) == contenttype {
+		option.Format = ""
+	}
+	option.AutoFormat = false
+	return reflect.DeepEqual(option, ImageOperatorOption{})
+}
+
+// OutputContentType returns content type of processed image.
+func (im *imageCreator) OutputContentType() string {
+	return OutputContentType(im.object.ContentType, ImageOperatorOption(*im.option))
+}
+
 // Decode images.
 func (im *imageCreator) Decode(ctx context.Context, src io.ReadSeeker) error {
-	var err error
-	im.object.Source, im.object.ImageName, err = image.Decode(src)
+	format, err := im.validateSourceSize(src)
 	if err != nil {
 		return err
 	}
-	if strings.HasPrefix(im.object.ContentType, "image/jpeg") {
-		im.decodeExifOrientation(ctx, src)
+	if im.option.Frame < 0 {
+		return fmt.Errorf("%w: %d", ErrFrameOutOfRange, im.option.Frame)
+	}
+	if format == "gif" {
+		// gif is decoded only once with all of its frames
+		im.object.ImageName = format
+		if err := im.decodeGifFrames(ctx, src); err != nil {
+			return err
+		}
+	} else {
+		if im.option.Frame > 1 {
+			return fmt.Errorf("%w: %d of 1", ErrFrameOutOfRange, im.option.Frame)
+		}
+		im.object.Source, im.object.ImageName, err = image.Decode(src)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(im.object.ContentType, "image/jpeg") {
+			im.decodeExifOrientation(ctx, src)
+		}
 	}
 	rectang := im.object.Source.Bounds()
 	im.object.OriginX = rectang.Bounds().Dx()
@@ -90,43 +274,192 @@ func (im *imageCreator) Decode(ctx context.Context, src io.ReadSeeker) error {
 
 // Process images process resize and more.
 func (im *imageCreator) Process(ctx context.Context) error {
-	if im.option.Gamma != 0 {
-		im.object.Source = im.gamma(im.object.Source)
+	if err := im.validateOption(); err != nil {
+		return err
 	}
-	if im.option.Contrast != 0 {
-		im.object.Source = im.contrast(im.object.Source)
+	if im.option.Trim > 0 {
+		im.trim()
+		log.Debug(ctx, fmt.Sprintf("TrimBox: %v", im.object.TrimBox))
 	}
-	if im.option.Brightness != 0 {
-		im.object.Source = im.brightness(im.object.Source)
+	if len(im.object.SourceFrames) > 1 {
+		return im.processFrames(ctx)
+	}
+	return im.processImage(ctx)
+}
+
+// validateOption validates keyword options.
+func (im *imageCreator) validateOption() error {
+	keywords := []struct {
+		name  string
+		value string
+		list  []string
+	}{
+		{"Fit", im.option.Fit, imageFitList},
+		{"Gravity", im.option.Gravity, imageGravityList},
+		{"Watermark Position", im.option.WatermarkPosition, imageOverlayPositionList},
+		{"Text Position", im.option.TextPosition, imageOverlayPositionList},
+		{"Flip", im.option.Flip, imageFlipList},
+		{"Compression", im.option.Compression, imageCompressionList},
+	}
+	for _, keyword := range keywords {
+		if keyword.value != "" && !utils.StringArrayContains(keyword.list, keyword.value) {
+			//nolint:err113
+			return fmt.Errorf("invalid %s Parameter", keyword.name)
+		}
+	}
+	if _, err := im.cornerRadius(0, 0); err != nil {
+		return err
+	}
+	if err := im.validateFloatOption(); err != nil {
+		return err
+	}
+	ranges := []struct {
+		name     string
+		value    float64
+		min, max float64
+	}{
+		{"Trim", float64(im.option.Trim), 1, maxTrimThreshold},
+		{"Dpr", im.option.Dpr, 1, maxDpr},
+		{"Watermark Scale", im.option.WatermarkScale, 0, 1},
+	}
+	for _, r := range ranges {
+		// zero is not specified
+		if r.value != 0 && (r.value < r.min || r.value > r.max) {
+			//nolint:err113
+			return fmt.Errorf("invalid %s Parameter", r.name)
+		}
 	}
+	if utf8.RuneCountInString(im.option.Text) > maxTextLength {
+		//nolint:err113
+		return fmt.Errorf("text must be %d characters or less", maxTextLength)
+	}
+	return nil
+}
+
+// validateFloatOption rejects NaN and Inf of float options, which break the size calculation of image.
+func (im *imageCreator) validateFloatOption() error {
+	floats := []struct {
+		name   string
+		values []float64
+	}{
+		{"Dpr", []float64{im.option.Dpr}},
+		{"Gamma", []float64{im.option.Gamma}},
+		{"Blur", []float64{im.option.Blur}},
+		{"Sharpen", im.option.Sharpen[:]},
+		{"Focal Point", im.option.FocalPoint[:]},
+		{"Color Matrix", im.option.ColorMatrix[:]},
+		{"Watermark Scale", []float64{im.option.WatermarkScale}},
+		{"Text Size", []float64{im.option.TextSize}},
+	}
+	for _, f := range floats {
+		for _, value := range f.values {
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				//nolint:err113
+				return fmt.Errorf("invalid %s Parameter", f.name)
+			}
+		}
+	}
+	return nil
+}
+
+// processImage processes a single image.
+func (im *imageCreator) processImage(ctx context.Context) error {
+	im.object.Source = im.adjustColor(im.object.Source)
+	var err error
 	switch {
 	case (im.option.Rotate != ""):
-		err := im.rotate(ctx)
-		if err != nil {
+		if err = im.rotate(ctx); err != nil {
 			return err
 		}
 		im.calcResizeXY(ctx)
-		return im.resize()
+		err = im.resize()
 	case !reflect.DeepEqual(im.option.Crop, [4]int{}):
 		im.calcResizeXYWithCrop(ctx)
-		return im.cropAndResize()
+		err = im.cropAndResize()
 	default:
 		im.calcResizeXY(ctx)
-		return im.resize()
+		err = im.resize()
+	}
+	if err != nil {
+		return err
+	}
+	if im.option.Flip != "" {
+		im.object.Dst = im.flip(im.object.Dst)
+	}
+	return im.applyEffects()
+}
+
+// applyEffects applies blur, sharpen, watermark, text and corner mask to resized image.
+func (im *imageCreator) applyEffects() error {
+	if im.option.Blur > 0 {
+		im.object.Dst = im.blur(im.object.Dst)
+	}
+	if im.option.Sharpen[0] > 0 {
+		im.object.Dst = im.sharpen(im.object.Dst)
+	}
+	if im.object.Watermark != nil {
+		dst, err := im.overlayWatermark(im.object.Dst)
+		if err != nil {
+			return err
+		}
+		im.object.Dst = dst
+	}
+	if im.option.Text != "" {
+		dst, err := im.overlayText(im.object.Dst)
+		if err != nil {
+			return err
+		}
+		im.object.Dst = dst
+	}
+	if im.option.Radius != "" {
+		im.object.Dst = im.roundCorners(im.object.Dst)
+	}
+	return nil
+}
+
+// adjustColor applies gamma, contrast, brightness and then color filters.
+func (im *imageCreator) adjustColor(src image.Image) image.Image {
+	if im.option.Gamma != 0 {
+		src = im.gamma(src)
+	}
+	if im.option.Contrast != 0 {
+		src = im.contrast(src)
+	}
+	if im.option.Brightness != 0 {
+		src = im.brightness(src)
 	}
+	if matrix, ok := im.colorFilterMatrix(); ok {
+		src = im.convertColorMatrix(src, matrix)
+	}
+	return src
+}
+
+// TrimBox returns trimmed bounds of source. It is empty when trim is not requested.
+func (im *imageCreator) TrimBox() image.Rectangle {
+	return im.object.TrimBox
 }
 
 // ImageByte get image bytes.
 func (im *imageCreator) ImageByte(_ context.Context) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	var err error
-	switch im.object.ContentType {
+	switch im.OutputContentType() {
 	case "image/jpeg":
-		err = jpeg.Encode(buf, im.object.Dst, im.jpegOption())
+		err = jpeg.Encode(buf, im.flatten(im.object.Dst), im.jpegOption())
 	case "image/png":
 		err = png.Encode(buf, im.object.Dst)
 	case "image/gif":
-		err = gif.Encode(buf, im.object.Dst, nil)
+		if len(im.object.DstFrames) > 1 {
+			err = im.encodeGifAnimation(buf)
+		} else {
+			err = gif.Encode(buf, im.object.Dst, nil)
+		}
+	case "image/webp":
+		err = im.encodeWebp(buf)
+	case "image/bmp":
+		err = bmp.Encode(buf, im.object.Dst)
+	case "image/tiff":
+		err = tiff.Encode(buf, im.object.Dst, im.tiffOption())
 	default:
 		//nolint:err113
 		err = errors.New("invalid format")
@@ -137,83 +470,290 @@ func (im *imageCreator) ImageByte(_ context.Context) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// flatten composites transparent image onto background for formats without alpha.
+// Background is white when bg is not given, and translucent bg is composited onto white.
+//
+//nolint:mnd
+func (im *imageCreator) flatten(src image.Image) image.Image {
+	if o, ok := src.(opaquer); ok && o.Opaque() {
+		return src
+	}
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(bounds)
+	draw.Draw(dst, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, bounds, image.NewUniform(im.option.Background), image.Point{}, draw.Over)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Over)
+	return dst
+}
+
 // resize images.
 func (im *imageCreator) resize() error {
+	if err := im.validateOutputSize(); err != nil {
+		return err
+	}
 	rect := image.Rect(0, 0, im.object.DstX, im.object.DstY)
-	im.object.Dst = im.scale(im.object.Source, rect, im.getDrawer())
+	im.object.Dst = im.fitCanvas(im.scale(im.object.Source, rect, im.getDrawer()))
 	return nil
 }
 
 // crop and resize images.
 func (im *imageCreator) cropAndResize() error {
-	croprect := image.Rect(im.option.Crop[0], im.option.Crop[1], im.option.Crop[2], im.option.Crop[3])
+	if err := im.validateOutputSize(); err != nil {
+		return err
+	}
+	// crop is given in coordinates of original source, which trim moved to the origin
+	croprect := image.Rect(im.option.Crop[0], im.option.Crop[1], im.option.Crop[2], im.option.Crop[3]).Sub(im.object.TrimBox.Min)
 	cropimg, err := im.subimage(im.object.Source, croprect)
 	if err != nil {
 		return err
 	}
 	scalerect := image.Rect(0, 0, im.object.DstX, im.object.DstY)
-	im.object.Dst = im.scale(cropimg, scalerect, im.getDrawer())
+	im.object.Dst = im.fitCanvas(im.scale(cropimg, scalerect, im.getDrawer()))
 	return nil
 }
 
+// fitCanvas crops or pads scaled image to the box of width and height.
+func (im *imageCreator) fitCanvas(src image.Image) image.Image {
+	if im.object.BoxX == 0 || im.object.BoxY == 0 {
+		return src
+	}
+	switch im.option.Fit {
+	case ImageFitCover:
+		// crop to the largest rectangle of box aspect within the resized image when it is not enlarged
+		bounds := src.Bounds()
+		ratio := math.Min(1, math.Min(float64(bounds.Dx())/float64(im.object.BoxX), float64(bounds.Dy())/float64(im.object.BoxY)))
+		width := min(bounds.Dx(), max(1, int(math.Round(float64(im.object.BoxX)*ratio))))
+		height := min(bounds.Dy(), max(1, int(math.Round(float64(im.object.BoxY)*ratio))))
+		return im.cropGravity(src, width, height)
+	case ImageFitContain, ImageFitPad:
+		return im.pad(src, im.object.BoxX, im.object.BoxY)
+	default:
+		return src
+	}
+}
+
+// cropGravity crops image to width and height anchored by gravity.
+func (im *imageCreator) cropGravity(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	var offset image.Point
+	if im.option.Gravity == ImageGravitySmart {
+		offset = bounds.Min.Add(im.smartCropOffset(src, width, height))
+	} else {
+		offset = bounds.Min.Add(im.gravityOffset(bounds.Dx(), bounds.Dy(), width, height))
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), src, offset, draw.Src)
+	return dst
+}
+
+// gravityOffset returns top left point of width x height window in srcx x srcy image.
+//
+//nolint:mnd
+func (im *imageCreator) gravityOffset(srcx, srcy, width, height int) image.Point {
+	overX := max(srcx-width, 0)
+	overY := max(srcy-height, 0)
+	if im.option.Gravity == ImageGravityFocalPoint {
+		x := int(im.option.FocalPoint[0]*float64(srcx)) - width/2
+		y := int(im.option.FocalPoint[1]*float64(srcy)) - height/2
+		return image.Pt(min(max(x, 0), overX), min(max(y, 0), overY))
+	}
+	return anchorOffset(im.option.Gravity, overX, overY)
+}
+
+// anchorOffset returns offset in the space of overX x overY anchored by gravity.
+//
+//nolint:mnd
+func anchorOffset(gravity string, overX, overY int) image.Point {
+	switch gravity {
+	case ImageGravityNorth:
+		return image.Pt(overX/2, 0)
+	case ImageGravityNorthEast:
+		return image.Pt(overX, 0)
+	case ImageGravityEast:
+		return image.Pt(overX, overY/2)
+	case ImageGravitySouthEast:
+		return image.Pt(overX, overY)
+	case ImageGravitySouth:
+		return image.Pt(overX/2, overY)
+	case ImageGravitySouthWest:
+		return image.Pt(0, overY)
+	case ImageGravityWest:
+		return image.Pt(0, overY/2)
+	case ImageGravityNorthWest:
+		return image.Pt(0, 0)
+	default:
+		return image.Pt(overX/2, overY/2)
+	}
+}
+
+// pad places image on the center of background canvas of width and height.
+//
+//nolint:mnd
+func (im *imageCreator) pad(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(im.option.Background), image.Point{}, draw.Src)
+	offset := image.Pt((width-bounds.Dx())/2, (height-bounds.Dy())/2)
+	draw.Draw(dst, bounds.Sub(bounds.Min).Add(offset), src, bounds.Min, draw.Over)
+	return dst
+}
+
 // rotate images.
 //
-//nolint:mnd,cyclop
+//nolint:mnd
 func (im *imageCreator) rotate(ctx context.Context) error {
-	originX := im.object.OriginX
-	originY := im.object.OriginY
 	switch im.option.Rotate {
 	case ImageRotateRight:
-		rect := image.Rect(0, 0, im.object.OriginY, im.object.OriginX)
-		im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 90.0, float64(im.object.OriginY), 0), im.getDrawer())
-		im.object.OriginX = originY
-		im.object.OriginY = originX
+		im.rotateRightAngle(ctx, 90)
 	case ImageRotateLeft:
-		rect := image.Rect(0, 0, im.object.OriginY, im.object.OriginX)
-		im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 270.0, 0, float64(im.object.OriginX)), im.getDrawer())
-		im.object.OriginX = originY
-		im.object.OriginY = originX
+		im.rotateRightAngle(ctx, 270)
 	case ImageRotateUpsidedown:
-		rect := image.Rect(0, 0, im.object.OriginX, im.object.OriginY)
-		im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 180.0, float64(im.object.OriginX), float64(im.object.OriginY)), im.getDrawer())
+		im.rotateRightAngle(ctx, 180)
 	case ImageRotateAutoVertical:
 		if im.object.OriginX > im.object.OriginY {
-			rect := image.Rect(0, 0, im.object.OriginY, im.object.OriginX)
-			im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 90.0, float64(im.object.OriginY), 0), im.getDrawer())
-			im.object.OriginX = originY
-			im.object.OriginY = originX
+			im.rotateRightAngle(ctx, 90)
 		}
 	case ImageRotateAutoHorizontal:
 		if im.object.OriginY > im.object.OriginX {
-			rect := image.Rect(0, 0, im.object.OriginY, im.object.OriginX)
-			im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 270.0, 0, float64(im.object.OriginX)), im.getDrawer())
-			im.object.OriginX = originY
-			im.object.OriginY = originX
+			im.rotateRightAngle(ctx, 270)
 		}
 	case ImageRotateExifOrientation:
-		if im.exifOrientation == 3 {
-			rect := image.Rect(0, 0, im.object.OriginY, im.object.OriginX)
-			im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 180.0, 0, float64(im.object.OriginX)), im.getDrawer())
-		}
-		if im.exifOrientation == 6 {
-			rect := image.Rect(0, 0, im.object.OriginY, im.object.OriginX)
-			im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 90.0, 0, float64(im.object.OriginX)), im.getDrawer())
-			im.object.OriginX = originY
-			im.object.OriginY = originX
-		}
-		if im.exifOrientation == 8 {
-			rect := image.Rect(0, 0, im.object.OriginY, im.object.OriginX)
-			im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 270.0, 0, float64(im.object.OriginX)), im.getDrawer())
-			im.object.OriginX = originY
-			im.object.OriginY = originX
-		}
+		im.rotateExifOrientation(ctx)
 	default:
-		//nolint:err113
-		return errors.New("invalid Rotate Parameter")
+		deg, err := strconv.ParseFloat(im.option.Rotate, 64)
+		if err != nil || math.IsNaN(deg) || math.IsInf(deg, 0) {
+			//nolint:err113
+			return errors.New("invalid Rotate Parameter")
+		}
+		return im.rotateAngle(ctx, deg)
 	}
 	return nil
 }
 
+// rotateAngle rotates source clockwise by any degree.
+// Canvas expands to fit rotated image and uncovered corners are filled with background.
+// Expanded canvas is checked against output limits before allocating it.
+//
+//nolint:mnd
+func (im *imageCreator) rotateAngle(ctx context.Context, deg float64) error {
+	deg = math.Mod(deg, 360)
+	if deg < 0 {
+		deg += 360
+	}
+	switch deg {
+	case 0:
+		return nil
+	case 90, 180, 270:
+		im.rotateRightAngle(ctx, int(deg))
+		return nil
+	}
+	rad := deg * math.Pi / 180
+	cos, sin := math.Abs(math.Cos(rad)), math.Abs(math.Sin(rad))
+	bounds := im.object.Source.Bounds()
+	srcX := float64(bounds.Dx())
+	srcY := float64(bounds.Dy())
+	// tolerance keeps float error from adding a pixel
+	dstX := int(math.Ceil(srcX*cos + srcY*sin - 1e-6))
+	dstY := int(math.Ceil(srcX*sin + srcY*cos - 1e-6))
+	if err := validateOutputPixels(dstX, dstY, max(1, len(im.object.SourceFrames))); err != nil {
+		return err
+	}
+
+	t := im.calcRotateAffine(ctx, deg, 0, 0)
+	centerX := float64(bounds.Min.X) + srcX/2
+	centerY := float64(bounds.Min.Y) + srcY/2
+	t[2] = float64(dstX)/2 - (t[0]*centerX + t[1]*centerY)
+	t[5] = float64(dstY)/2 - (t[3]*centerX + t[4]*centerY)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstX, dstY))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(im.option.Background), image.Point{}, draw.Src)
+	im.getDrawer().Transform(dst, t, im.object.Source, bounds, draw.Over, nil)
+	im.object.Source = dst
+	im.object.OriginX = dstX
+	im.object.OriginY = dstY
+	return nil
+}
+
+// rotateExifOrientation rotates and mirrors image to display orientation of exif.
+//
+//nolint:mnd
+func (im *imageCreator) rotateExifOrientation(ctx context.Context) {
+	switch im.exifOrientation {
+	case 2:
+		im.object.Source = im.mirror(im.object.Source, true, false)
+	case 3:
+		im.rotateRightAngle(ctx, 180)
+	case 4:
+		im.object.Source = im.mirror(im.object.Source, false, true)
+	case 5:
+		im.object.Source = im.mirror(im.object.Source, true, false)
+		im.rotateRightAngle(ctx, 270)
+	case 6:
+		im.rotateRightAngle(ctx, 90)
+	case 7:
+		im.object.Source = im.mirror(im.object.Source, true, false)
+		im.rotateRightAngle(ctx, 90)
+	case 8:
+		im.rotateRightAngle(ctx, 270)
+	}
+}
+
+// rotateRightAngle rotates source clockwise by 90, 180 or 270 degree.
+//
+//nolint:mnd
+func (im *imageCreator) rotateRightAngle(ctx context.Context, deg int) {
+	originX := im.object.OriginX
+	originY := im.object.OriginY
+	switch deg {
+	case 90:
+		rect := image.Rect(0, 0, originY, originX)
+		im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 90.0, float64(originY), 0), im.getDrawer())
+	case 180:
+		rect := image.Rect(0, 0, originX, originY)
+		im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 180.0, float64(originX), float64(originY)), im.getDrawer())
+		return
+	case 270:
+		rect := image.Rect(0, 0, originY, originX)
+		im.object.Source = im.transform(im.object.Source, rect, im.calcRotateAffine(ctx, 270.0, 0, float64(originX)), im.getDrawer())
+	default:
+		return
+	}
+	im.object.OriginX = originY
+	im.object.OriginY = originX
+}
+
+// flip resized image horizontally and / or vertically.
+func (im *imageCreator) flip(src image.Image) image.Image {
+	switch im.option.Flip {
+	case ImageFlipHorizontal:
+		return im.mirror(src, true, false)
+	case ImageFlipVertical:
+		return im.mirror(src, false, true)
+	case ImageFlipBoth:
+		return im.mirror(src, true, true)
+	default:
+		return src
+	}
+}
+
+// mirror image horizontally and / or vertically.
+func (im *imageCreator) mirror(src image.Image, horizontal, vertical bool) image.Image {
+	bounds := src.Bounds()
+	t := f64.Aff3{
+		1, 0, float64(-bounds.Min.X),
+		0, 1, float64(-bounds.Min.Y),
+	}
+	if horizontal {
+		t[0] = -1
+		t[2] = float64(bounds.Max.X)
+	}
+	if vertical {
+		t[4] = -1
+		t[5] = float64(bounds.Max.Y)
+	}
+	return im.transform(src, image.Rect(0, 0, bounds.Dx(), bounds.Dy()), t, draw.NearestNeighbor)
+}
+
 // scale image.
 func (im *imageCreator) scale(src image.Image, rect image.Rectangle, scaler draw.Scaler) image.Image {
 	dst := image.NewNRGBA(rect)
@@ -308,6 +848,104 @@ func (im *imageCreator) convertLuminance(src image.Image, lookup []uint8) *image
 	return dst
 }
 
+// blur image by gaussian.
+func (im *imageCreator) blur(src image.Image) *image.NRGBA {
+	return im.gaussianBlur(src, math.Min(im.option.Blur, maxBlurSigma))
+}
+
+// sharpen image by unsharp mask of amount, sigma and threshold.
+//
+//nolint:mnd
+func (im *imageCreator) sharpen(src image.Image) *image.NRGBA {
+	amount := im.option.Sharpen[0]
+	sigma := im.option.Sharpen[1]
+	if sigma <= 0 {
+		sigma = 1.0
+	}
+	threshold := im.option.Sharpen[2]
+	blurred := im.gaussianBlur(src, math.Min(sigma, maxBlurSigma))
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(bounds)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+	utils.ApplyParallel(0, dst.Bounds().Dy(), func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := range dst.Bounds().Dx() {
+				dstPos := y*dst.Stride + x*4
+				for i := range 3 {
+					diff := float64(dst.Pix[dstPos+i]) - float64(blurred.Pix[dstPos+i])
+					if math.Abs(diff) < threshold {
+						continue
+					}
+					dst.Pix[dstPos+i] = uint8(utils.InRanged(math.Round(float64(dst.Pix[dstPos+i])+amount*diff), 0, 255))
+				}
+			}
+		}
+	})
+	return dst
+}
+
+// gaussianBlur blurs image in premultiplied color to avoid dark fringes at transparent edges.
+func (im *imageCreator) gaussianBlur(src image.Image, sigma float64) *image.NRGBA {
+	bounds := src.Bounds()
+	premultiplied := image.NewRGBA(bounds)
+	draw.Draw(premultiplied, bounds, src, bounds.Min, draw.Src)
+	kernel := im.gaussianKernel(sigma)
+	tmp := image.NewRGBA(bounds)
+	im.convolve(tmp, premultiplied, kernel, true)
+	im.convolve(premultiplied, tmp, kernel, false)
+	dst := image.NewNRGBA(bounds)
+	draw.Draw(dst, bounds, premultiplied, bounds.Min, draw.Src)
+	return dst
+}
+
+//nolint:mnd
+func (im *imageCreator) gaussianKernel(sigma float64) []float64 {
+	radius := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, radius*2+1)
+	var sum float64
+	for i := range kernel {
+		x := float64(i - radius)
+		kernel[i] = math.Exp(-(x * x) / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// convolve applies one dimensional kernel horizontally or vertically.
+//
+//nolint:mnd
+func (im *imageCreator) convolve(dst, src *image.RGBA, kernel []float64, horizontal bool) {
+	width := src.Bounds().Dx()
+	height := src.Bounds().Dy()
+	radius := len(kernel) / 2
+	utils.ApplyParallel(0, height, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := range width {
+				var sum [4]float64
+				for k, weight := range kernel {
+					srcX, srcY := x, y
+					if horizontal {
+						srcX = min(max(x+k-radius, 0), width-1)
+					} else {
+						srcY = min(max(y+k-radius, 0), height-1)
+					}
+					srcPos := srcY*src.Stride + srcX*4
+					for i := range 4 {
+						sum[i] += float64(src.Pix[srcPos+i]) * weight
+					}
+				}
+				dstPos := y*dst.Stride + x*4
+				for i := range 4 {
+					dst.Pix[dstPos+i] = uint8(utils.InRanged(math.Round(sum[i]), 0, 255))
+				}
+			}
+		}
+	})
+}
+
 //nolint:mnd,ireturn
 func (im *imageCreator) getDrawer() draw.Interpolator {
 	switch im.option.Quality {
@@ -324,57 +962,96 @@ func (im *imageCreator) getDrawer() draw.Interpolator {
 	}
 }
 
-//nolint:cyclop
 func (im *imageCreator) calcResizeXY(ctx context.Context) {
-	log.Debug(ctx, fmt.Sprintf("OptionX: %d / OptionY: %d", im.option.Width, im.option.Height))
-	switch {
-	case (im.option.Width == 0 && im.option.Height == 0):
-		im.object.DstX = im.object.OriginX
-		im.object.DstY = im.object.OriginY
-	case (im.option.Width != 0 && im.option.Height == 0),
-		(im.option.Width != 0 && im.option.Height != 0 && float64(im.object.OriginY)/float64(im.object.OriginX) <= float64(im.option.Height)/float64(im.option.Width)):
-		im.calcResizeFitOptionWidth(im.object.OriginX, im.object.OriginY)
-	case (im.option.Width == 0 && im.option.Height != 0),
-		(im.option.Width != 0 && im.option.Height != 0 && float64(im.object.OriginY)/float64(im.object.OriginX) > float64(im.option.Height)/float64(im.option.Width)):
-		im.calcResizeFitOptionHeight(im.object.OriginX, im.object.OriginY)
-	}
+	log.Debug(ctx, fmt.Sprintf("OptionX: %d / OptionY: %d / Dpr: %v", im.option.Width, im.option.Height, im.option.Dpr))
+	im.calcResizeBox(im.object.OriginX, im.object.OriginY)
+	im.calcResizeFit(im.object.OriginX, im.object.OriginY)
 	log.Debug(ctx, fmt.Sprintf("DstX: %d / DstY: %d", im.object.DstX, im.object.DstY))
 }
 
-//nolint:cyclop
 func (im *imageCreator) calcResizeXYWithCrop(ctx context.Context) {
-	log.Debug(ctx, fmt.Sprintf("OptionX: %d / OptionY: %d", im.option.Width, im.option.Height))
+	log.Debug(ctx, fmt.Sprintf("OptionX: %d / OptionY: %d / Dpr: %v", im.option.Width, im.option.Height, im.option.Dpr))
 	log.Debug(ctx, fmt.Sprintf("Crop: %v", im.option.Crop))
 	cropedX := int(math.Abs(float64(im.option.Crop[2] - im.option.Crop[0])))
 	cropedY := int(math.Abs(float64(im.option.Crop[3] - im.option.Crop[1])))
+	im.calcResizeBox(cropedX, cropedY)
+	im.calcResizeFit(cropedX, cropedY)
+	log.Debug(ctx, fmt.Sprintf("DstX: %d / DstY: %d", im.object.DstX, im.object.DstY))
+}
+
+// calcResizeBox calculates box of width and height options multiplied by device pixel ratio.
+// Unless enlarge is allowed, the ratio is capped so that the box does not exceed origin, but never below 1.
+func (im *imageCreator) calcResizeBox(originx, originy int) {
+	im.object.BoxX = im.option.Width
+	im.object.BoxY = im.option.Height
+	if im.option.Dpr <= 1 {
+		return
+	}
+	ratio := im.option.Dpr
+	if !im.option.Enlarge {
+		im.calcResizeFit(originx, originy)
+		limit := math.Min(float64(originx)/float64(im.object.DstX), float64(originy)/float64(im.object.DstY))
+		ratio = min(ratio, max(1, limit))
+	}
+	im.object.BoxX = int(math.Round(float64(im.option.Width) * ratio))
+	im.object.BoxY = int(math.Round(float64(im.option.Height) * ratio))
+}
+
+// calcResizeFit calculates scaled size of origin by box and fit options.
+//
+//nolint:cyclop
+func (im *imageCreator) calcResizeFit(originx, originy int) {
 	switch {
-	case (im.option.Width == 0 && im.option.Height == 0):
-		im.object.DstX = cropedX
-		im.object.DstY = cropedY
-	case (im.option.Width != 0 && im.option.Height == 0),
-		(im.option.Width != 0 && im.option.Height != 0 && float64(cropedY)/float64(cropedX) <= float64(im.option.Height)/float64(im.option.Width)):
-		im.calcResizeFitOptionWidth(cropedX, cropedY)
-	case (im.option.Width == 0 && im.option.Height != 0),
-		(im.option.Width != 0 && im.option.Height != 0 && float64(cropedY)/float64(cropedX) > float64(im.option.Height)/float64(im.option.Width)):
-		im.calcResizeFitOptionHeight(cropedX, cropedY)
+	case (im.object.BoxX == 0 && im.object.BoxY == 0):
+		im.object.DstX = originx
+		im.object.DstY = originy
+	case (im.object.BoxY == 0):
+		im.calcResizeFitOptionWidth(originx, originy)
+	case (im.object.BoxX == 0):
+		im.calcResizeFitOptionHeight(originx, originy)
+	case (im.option.Fit == ImageFitFill):
+		im.object.DstX = im.object.BoxX
+		im.object.DstY = im.object.BoxY
+	case im.isFitWidth(originx, originy):
+		im.calcResizeFitOptionWidth(originx, originy)
+	default:
+		im.calcResizeFitOptionHeight(originx, originy)
+	}
+	if im.option.Fit == ImageFitCover && im.object.BoxX != 0 && im.object.BoxY != 0 {
+		// avoid rounding the covering size below the box
+		im.object.DstX = max(im.object.DstX, im.object.BoxX)
+		im.object.DstY = max(im.object.DstY, im.object.BoxY)
+	}
+	if !im.option.Enlarge {
+		im.shrinkToOrigin(originx, originy)
+	}
+}
+
+// isFitWidth reports whether width option decides the scale when both width and height are given.
+func (im *imageCreator) isFitWidth(originx, originy int) bool {
+	widthFits := float64(originy)/float64(originx) <= float64(im.object.BoxY)/float64(im.object.BoxX)
+	switch im.option.Fit {
+	case ImageFitOutside, ImageFitCover:
+		return !widthFits
+	default:
+		return widthFits
 	}
-	log.Debug(ctx, fmt.Sprintf("DstX: %d / DstY: %d", im.object.DstX, im.object.DstY))
 }
 
 func (im *imageCreator) calcResizeFitOptionWidth(originx, originy int) {
-	im.object.DstX = im.option.Width
+	im.object.DstX = im.object.BoxX
 	im.object.DstY = originy
 	if originx != 0 {
-		im.object.DstY = int(float64(im.option.Width) * (float64(originy) / float64(originx)))
+		im.object.DstY = int(float64(im.object.BoxX) * (float64(originy) / float64(originx)))
 	}
 }
 
 func (im *imageCreator) calcResizeFitOptionHeight(originx, originy int) {
 	im.object.DstX = originx
 	if originy != 0 {
-		im.object.DstX = int(float64(im.option.Height) * (float64(originx) / float64(originy)))
+		im.object.DstX = int(float64(im.object.BoxY) * (float64(originx) / float64(originy)))
 	}
-	im.object.DstY = im.option.Height
+	im.object.DstY = im.object.BoxY
 }
 
 //nolint:mnd
@@ -404,6 +1081,40 @@ func (im *imageCreator) jpegOption() *jpeg.Options {
 	}
 }
 
+func (im *imageCreator) tiffOption() *tiff.Options {
+	if im.option.Compression == ImageCompressionNone {
+		return &tiff.Options{Compression: tiff.Uncompressed}
+	}
+	return &tiff.Options{Compression: tiff.Deflate}
+}
+
+// encodeWebp encodes dst as lossy webp with quality of q option, or losslessly.
+func (im *imageCreator) encodeWebp(w io.Writer) error {
+	return webp.Encode(w, im.object.Dst, im.webpOption())
+}
+
+// webpOption maps q option to webp quality.
+// Highest quality is 95 since libwebp treats 100 as lossless.
+//
+//nolint:mnd
+func (im *imageCreator) webpOption() webp.Options {
+	if im.option.Lossless {
+		return webp.Options{Lossless: true, Method: 4}
+	}
+	switch im.option.Quality {
+	case 1:
+		return webp.Options{Quality: 75, Method: 4}
+	case 2:
+		return webp.Options{Quality: 85, Method: 4}
+	case 3:
+		return webp.Options{Quality: 90, Method: 4}
+	case 4:
+		return webp.Options{Quality: 95, Method: 4}
+	default:
+		return webp.Options{Quality: 85, Method: 4}
+	}
+}
+
 func (im *imageCreator) decodeExifOrientation(ctx context.Context, src io.ReadSeeker) {
 	if _, err := src.Seek(0, io.SeekStart); err != nil {
 		log.Debug(ctx, fmt.Sprintf("reader seek 0 error %v", err.Error()))
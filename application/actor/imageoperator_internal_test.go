@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"image"
 	"image/color"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"testing"
@@ -126,3 +127,375 @@ func Test_ImageByte_GIF(t *testing.T) {
 		t.Fatal("expected non-empty GIF output")
 	}
 }
+
+func Test_GravityOffset(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		gravity    string
+		focalPoint [2]float64
+		want       image.Point
+	}{
+		{"", [2]float64{}, image.Pt(50, 20)},
+		{ImageGravityCenter, [2]float64{}, image.Pt(50, 20)},
+		{ImageGravityNorth, [2]float64{}, image.Pt(50, 0)},
+		{ImageGravityNorthEast, [2]float64{}, image.Pt(100, 0)},
+		{ImageGravityEast, [2]float64{}, image.Pt(100, 20)},
+		{ImageGravitySouthEast, [2]float64{}, image.Pt(100, 40)},
+		{ImageGravitySouth, [2]float64{}, image.Pt(50, 40)},
+		{ImageGravitySouthWest, [2]float64{}, image.Pt(0, 40)},
+		{ImageGravityWest, [2]float64{}, image.Pt(0, 20)},
+		{ImageGravityNorthWest, [2]float64{}, image.Pt(0, 0)},
+		{ImageGravityFocalPoint, [2]float64{0.5, 0.5}, image.Pt(50, 20)},
+		{ImageGravityFocalPoint, [2]float64{0.3, 0.6}, image.Pt(10, 30)},
+		{ImageGravityFocalPoint, [2]float64{0, 1}, image.Pt(0, 40)},
+	}
+	for _, tc := range cases {
+		im := newImageCreator("image/png", ImageOperatorOption{Gravity: tc.gravity, FocalPoint: tc.focalPoint}, 0)
+		// 200x100 scaled image into 100x60 box
+		if got := im.gravityOffset(200, 100, 100, 60); got != tc.want {
+			t.Errorf("gravity %q fp %v: offset = %v, want %v", tc.gravity, tc.focalPoint, got, tc.want)
+		}
+	}
+}
+
+func Test_Process_GravityCover(t *testing.T) {
+	t.Parallel()
+
+	// left half red, right half blue
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+	for y := range 50 {
+		for x := range 100 {
+			if x < 50 {
+				src.Set(x, y, color.NRGBA{R: 255, A: 255})
+			} else {
+				src.Set(x, y, color.NRGBA{B: 255, A: 255})
+			}
+		}
+	}
+	for gravity, want := range map[string]color.NRGBA{
+		ImageGravityWest: {R: 255, A: 255},
+		ImageGravityEast: {B: 255, A: 255},
+	} {
+		im := newImageCreator("image/png", ImageOperatorOption{Width: 20, Height: 20, Fit: ImageFitCover, Gravity: gravity}, 0)
+		im.object.Source = src
+		im.object.OriginX, im.object.OriginY = 100, 50
+		if err := im.Process(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		if b := im.object.Dst.Bounds(); b.Dx() != 20 || b.Dy() != 20 {
+			t.Fatalf("expected 20x20, got %v", b)
+		}
+		if got := color.NRGBAModel.Convert(im.object.Dst.At(10, 10)); got != want {
+			t.Fatalf("gravity %q: color = %v, want %v", gravity, got, want)
+		}
+	}
+}
+
+func Test_Process_GravityInvalid(t *testing.T) {
+	t.Parallel()
+
+	im := newImageCreator("image/png", ImageOperatorOption{Gravity: "up"}, 0)
+	if err := im.Decode(t.Context(), newInternalTestPNG(t, 10, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := im.Process(t.Context()); err == nil {
+		t.Fatal("expected error for invalid gravity")
+	}
+}
+
+func newInternalTestMarkerImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			if x < 2 && y < 2 {
+				img.Set(x, y, color.NRGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.NRGBA{B: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func Test_Rotate_ExifOrientation_All(t *testing.T) {
+	t.Parallel()
+
+	// want is where the top left marker of 8x4 source lands
+	tests := map[int]struct {
+		size image.Point
+		want image.Point
+	}{
+		1: {image.Pt(8, 4), image.Pt(0, 0)},
+		2: {image.Pt(8, 4), image.Pt(7, 0)},
+		3: {image.Pt(8, 4), image.Pt(7, 3)},
+		4: {image.Pt(8, 4), image.Pt(0, 3)},
+		5: {image.Pt(4, 8), image.Pt(0, 0)},
+		6: {image.Pt(4, 8), image.Pt(3, 0)},
+		7: {image.Pt(4, 8), image.Pt(3, 7)},
+		8: {image.Pt(4, 8), image.Pt(0, 7)},
+	}
+	for orientation, tt := range tests {
+		im := newImageCreator("image/png", ImageOperatorOption{Rotate: ImageRotateExifOrientation}, orientation)
+		im.object.Source = newInternalTestMarkerImage(8, 4)
+		im.object.OriginX = 8
+		im.object.OriginY = 4
+		if err := im.rotate(t.Context()); err != nil {
+			t.Fatalf("orientation %d: %v", orientation, err)
+		}
+		if got := im.object.Source.Bounds().Size(); got != tt.size || image.Pt(im.object.OriginX, im.object.OriginY) != tt.size {
+			t.Fatalf("orientation %d: size = %v / origin %d x %d, want %v", orientation, got, im.object.OriginX, im.object.OriginY, tt.size)
+		}
+		if r, _, _, _ := im.object.Source.At(tt.want.X, tt.want.Y).RGBA(); r>>8 != 255 {
+			t.Errorf("orientation %d: marker is not at %v", orientation, tt.want)
+		}
+	}
+}
+
+func Test_Flip(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]image.Point{
+		"":                  image.Pt(0, 0),
+		ImageFlipHorizontal: image.Pt(7, 0),
+		ImageFlipVertical:   image.Pt(0, 3),
+		ImageFlipBoth:       image.Pt(7, 3),
+	}
+	for flip, want := range tests {
+		im := newImageCreator("image/png", ImageOperatorOption{Flip: flip}, 0)
+		dst := im.flip(newInternalTestMarkerImage(8, 4))
+		if dst.Bounds() != image.Rect(0, 0, 8, 4) {
+			t.Fatalf("flip %q: bounds = %v", flip, dst.Bounds())
+		}
+		if r, _, _, _ := dst.At(want.X, want.Y).RGBA(); r>>8 != 255 {
+			t.Errorf("flip %q: marker is not at %v", flip, want)
+		}
+	}
+}
+
+func Test_Process_FlipWithRotate(t *testing.T) {
+	t.Parallel()
+
+	// rotate right moves the marker to top right, then flip h moves it back to top left
+	im := newImageCreator("image/png", ImageOperatorOption{Rotate: ImageRotateRight, Flip: ImageFlipHorizontal}, 0)
+	im.object.Source = newInternalTestMarkerImage(8, 4)
+	im.object.OriginX = 8
+	im.object.OriginY = 4
+	if err := im.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if im.object.Dst.Bounds().Size() != image.Pt(4, 8) {
+		t.Fatalf("size = %v", im.object.Dst.Bounds().Size())
+	}
+	if r, _, _, _ := im.object.Dst.At(0, 0).RGBA(); r>>8 != 255 {
+		t.Fatal("marker is not at top left")
+	}
+}
+
+func Test_Process_FlipInvalid(t *testing.T) {
+	t.Parallel()
+
+	im := newImageCreator("image/png", ImageOperatorOption{Flip: "x"}, 0)
+	if err := im.Decode(t.Context(), newInternalTestPNG(t, 20, 20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := im.Process(t.Context()); err == nil {
+		t.Fatal("expected error for invalid flip, got nil")
+	}
+}
+
+func Test_Rotate_Angle(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		background color.NRGBA
+		size       image.Point
+		corner     color.NRGBA
+	}{
+		"30":       {color.NRGBA{}, image.Pt(45, 38), color.NRGBA{}},
+		"-30":      {color.NRGBA{}, image.Pt(45, 38), color.NRGBA{}},
+		"12.5":     {color.NRGBA{R: 255, G: 255, B: 255, A: 255}, image.Pt(44, 29), color.NRGBA{R: 255, G: 255, B: 255, A: 255}},
+		"45":       {color.NRGBA{R: 255, A: 128}, image.Pt(43, 43), color.NRGBA{R: 255, A: 128}},
+		"90":       {color.NRGBA{}, image.Pt(20, 40), color.NRGBA{R: 100, G: 150, B: 200, A: 255}},
+		"-90":      {color.NRGBA{}, image.Pt(20, 40), color.NRGBA{R: 100, G: 150, B: 200, A: 255}},
+		"360":      {color.NRGBA{}, image.Pt(40, 20), color.NRGBA{R: 100, G: 150, B: 200, A: 255}},
+		"180.0":    {color.NRGBA{}, image.Pt(40, 20), color.NRGBA{R: 100, G: 150, B: 200, A: 255}},
+		"0.000001": {color.NRGBA{}, image.Pt(40, 20), color.NRGBA{R: 100, G: 150, B: 200, A: 255}},
+	}
+	for deg, tt := range tests {
+		im := newImageCreator("image/png", ImageOperatorOption{Rotate: deg, Background: tt.background}, 0)
+		if err := im.Decode(t.Context(), newInternalTestPNG(t, 40, 20)); err != nil {
+			t.Fatal(err)
+		}
+		if err := im.rotate(t.Context()); err != nil {
+			t.Fatalf("rotate %s: %v", deg, err)
+		}
+		if got := im.object.Source.Bounds().Size(); got != tt.size || image.Pt(im.object.OriginX, im.object.OriginY) != tt.size {
+			t.Fatalf("rotate %s: size = %v / origin %d x %d, want %v", deg, got, im.object.OriginX, im.object.OriginY, tt.size)
+		}
+		if got := color.NRGBAModel.Convert(im.object.Source.At(0, 0)); got != tt.corner {
+			t.Errorf("rotate %s: corner = %v, want %v", deg, got, tt.corner)
+		}
+		center := color.NRGBAModel.Convert(im.object.Source.At(tt.size.X/2, tt.size.Y/2))
+		if center != (color.NRGBA{R: 100, G: 150, B: 200, A: 255}) {
+			t.Errorf("rotate %s: center = %v", deg, center)
+		}
+	}
+}
+
+func Test_Rotate_AngleInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, deg := range []string{"NaN", "Inf", "12deg"} {
+		im := newImageCreator("image/png", ImageOperatorOption{Rotate: deg}, 0)
+		if err := im.Decode(t.Context(), newInternalTestPNG(t, 20, 20)); err != nil {
+			t.Fatal(err)
+		}
+		if err := im.rotate(t.Context()); err == nil {
+			t.Fatalf("rotate %s: expected error, got nil", deg)
+		}
+	}
+}
+
+func Test_countGifFrames(t *testing.T) {
+	t.Parallel()
+
+	// frames with their own palettes are written with local color tables
+	animation := &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.Black, color.White}),
+			image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.White, color.Black, color.Transparent}),
+			image.NewPaletted(image.Rect(1, 1, 3, 3), color.Palette{color.Black}),
+		},
+		Delay:     []int{10, 10, 10},
+		LoopCount: 1,
+	}
+	buf := new(bytes.Buffer)
+	if err := gif.EncodeAll(buf, animation); err != nil {
+		t.Fatal(err)
+	}
+	frames, err := countGifFrames(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames != 3 {
+		t.Errorf("expected 3 frames, got %d", frames)
+	}
+	if _, err := countGifFrames(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Error("expected error for truncated gif")
+	}
+}
+
+func Test_Trim_RotateRightAngle(t *testing.T) {
+	t.Parallel()
+
+	// content is far from the origin so that rotation assuming the origin of source misses it
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 160))
+	for y := range 160 {
+		for x := range 200 {
+			src.Set(x, y, color.White)
+		}
+	}
+	for y := 110; y < 140; y++ {
+		for x := 120; x < 180; x++ {
+			src.Set(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+	tests := map[string]struct {
+		rotate          string
+		exifOrientation int
+	}{
+		"right":      {ImageRotateRight, 0},
+		"left":       {ImageRotateLeft, 0},
+		"upsidedown": {ImageRotateUpsidedown, 0},
+		"exif 3":     {ImageRotateExifOrientation, 3},
+		"exif 6":     {ImageRotateExifOrientation, 6},
+		"exif 8":     {ImageRotateExifOrientation, 8},
+	}
+	for name, tt := range tests {
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, src); err != nil {
+			t.Fatal(err)
+		}
+		im := newImageCreator("image/png", ImageOperatorOption{Trim: 10, Rotate: tt.rotate}, tt.exifOrientation)
+		if err := im.Decode(t.Context(), bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		if err := im.Process(t.Context()); err != nil {
+			t.Fatalf("%s: Process: %v", name, err)
+		}
+		b, err := im.ImageByte(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bounds := img.Bounds()
+		if _, _, _, a := img.At(bounds.Dx()/2, bounds.Dy()/2).RGBA(); a == 0 {
+			t.Errorf("%s: center pixel is transparent", name)
+		}
+	}
+}
+
+func Test_Trim_Crop(t *testing.T) {
+	t.Parallel()
+
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	for y := range 100 {
+		for x := range 100 {
+			src.Set(x, y, color.White)
+		}
+	}
+	for y := 30; y < 70; y++ {
+		for x := 30; x < 70; x++ {
+			src.Set(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err)
+	}
+	im := newImageCreator("image/png", ImageOperatorOption{Trim: 10, Crop: [4]int{40, 40, 60, 60}}, 0)
+	if err := im.Decode(t.Context(), bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if err := im.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	bounds := im.object.Dst.Bounds()
+	if bounds.Dx() != 20 || bounds.Dy() != 20 {
+		t.Fatalf("size = %v, want 20x20", bounds.Size())
+	}
+	if got := color.NRGBAModel.Convert(im.object.Dst.At(bounds.Min.X+10, bounds.Min.Y+10)); got != (color.NRGBA{R: 200, A: 255}) {
+		t.Errorf("center pixel = %v, want content of crop", got)
+	}
+}
+
+func Test_DilateAlpha(t *testing.T) {
+	t.Parallel()
+
+	mask := image.NewAlpha(image.Rect(0, 0, 9, 9))
+	mask.SetAlpha(4, 4, color.Alpha{A: 255})
+	mask.SetAlpha(0, 0, color.Alpha{A: 100})
+	dst := dilateAlpha(mask, 2)
+	var count int
+	for y := range 9 {
+		for x := range 9 {
+			if dst.AlphaAt(x, y).A == 255 {
+				count++
+			}
+		}
+	}
+	// disc of radius 2 covers 13 pixels
+	if count != 13 {
+		t.Errorf("dilated pixels = %d, want 13", count)
+	}
+	if dst.AlphaAt(6, 4).A != 255 || dst.AlphaAt(6, 6).A != 0 {
+		t.Errorf("dilation should be a disc: edge %v, corner %v", dst.AlphaAt(6, 4), dst.AlphaAt(6, 6))
+	}
+	if dst.AlphaAt(1, 1).A != 100 {
+		t.Errorf("partial alpha should spread as is, got %v", dst.AlphaAt(1, 1))
+	}
+}
@@ -2,10 +2,15 @@ package actor_test
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/jpeg"
 	"image/png"
+	"math"
 	"strings"
 	"testing"
 
@@ -313,6 +318,277 @@ func Test_ImageOperator_ImageByte_InvalidContentType(t *testing.T) {
 	}
 }
 
+func Test_OutputContentType(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		contenttype string
+		option      actor.ImageOperatorOption
+		want        string
+	}{
+		"original":      {"image/png", actor.ImageOperatorOption{}, "image/png"},
+		"format":        {"image/jpeg", actor.ImageOperatorOption{Format: actor.ImageFormatWebp}, "image/webp"},
+		"auto png":      {"image/png", actor.ImageOperatorOption{Format: actor.ImageFormatWebp, AutoFormat: true}, "image/webp"},
+		"auto jpeg":     {"image/jpeg", actor.ImageOperatorOption{Format: actor.ImageFormatWebp, AutoFormat: true}, "image/webp"},
+		"auto original": {"image/gif", actor.ImageOperatorOption{AutoFormat: true}, "image/gif"},
+	}
+	for name, tt := range tests {
+		if got := actor.OutputContentType(tt.contenttype, tt.option); got != tt.want {
+			t.Errorf("%s: OutputContentType = %q, want %q", name, got, tt.want)
+		}
+	}
+}
+
+func Test_IsPassthroughOption(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		contenttype string
+		option      actor.ImageOperatorOption
+		want        bool
+	}{
+		"empty":           {"image/jpeg", actor.ImageOperatorOption{}, true},
+		"auto unchanged":  {"image/jpeg", actor.ImageOperatorOption{AutoFormat: true}, true},
+		"auto same":       {"image/webp", actor.ImageOperatorOption{Format: actor.ImageFormatWebp, AutoFormat: true}, true},
+		"auto negotiated": {"image/jpeg", actor.ImageOperatorOption{Format: actor.ImageFormatWebp, AutoFormat: true}, false},
+		"auto resize":     {"image/jpeg", actor.ImageOperatorOption{Width: 10, AutoFormat: true}, false},
+		"format":          {"image/jpeg", actor.ImageOperatorOption{Format: actor.ImageFormatJpeg}, false},
+	}
+	for name, tt := range tests {
+		if got := actor.IsPassthroughOption(tt.contenttype, tt.option); got != tt.want {
+			t.Errorf("%s: IsPassthroughOption = %v, want %v", name, got, tt.want)
+		}
+	}
+}
+
+func Test_ImageOperator_WebP_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, option := range []actor.ImageOperatorOption{
+		{Width: 40},
+		{Width: 40, Quality: 1},
+		{Width: 40, Lossless: true},
+	} {
+		op := actor.NewImageOperator("image/webp", option)
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 80, 40)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		out, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatalf("ImageByte webp: %v", err)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("decode webp output: %v", err)
+		}
+		if format != "webp" || cfg.Width != 40 || cfg.Height != 20 {
+			t.Fatalf("expected 40x20 webp, got %dx%d %s", cfg.Width, cfg.Height, format)
+		}
+		// decode the encoded webp again as a source image
+		op2 := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Width: 20})
+		if err := op2.Decode(t.Context(), bytes.NewReader(out)); err != nil {
+			t.Fatalf("Decode webp: %v", err)
+		}
+	}
+}
+
+func Test_ImageOperator_WebP_Quality(t *testing.T) {
+	t.Parallel()
+
+	// textured source so that quality changes the size of output
+	src := image.NewNRGBA(image.Rect(0, 0, 120, 120))
+	for y := range 120 {
+		for x := range 120 {
+			src.Set(x, y, color.NRGBA{R: uint8(x * 2), G: uint8(y * 2), B: uint8((x * y) % 256), A: 255})
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err)
+	}
+	encode := func(option actor.ImageOperatorOption) []byte {
+		t.Helper()
+		op := actor.NewImageOperator("image/png", option)
+		if err := op.Decode(t.Context(), bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		out, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	low := encode(actor.ImageOperatorOption{Format: actor.ImageFormatWebp, Quality: 1})
+	high := encode(actor.ImageOperatorOption{Format: actor.ImageFormatWebp, Quality: 4})
+	lossless := encode(actor.ImageOperatorOption{Format: actor.ImageFormatWebp, Quality: 1, Lossless: true})
+	// chunk following RIFF header tells lossy (VP8) or lossless (VP8L)
+	if string(low[12:16]) != "VP8 " || string(high[12:16]) != "VP8 " {
+		t.Fatalf("expected lossy webp, got %q and %q", low[12:16], high[12:16])
+	}
+	if string(lossless[12:16]) != "VP8L" {
+		t.Fatalf("expected lossless webp, got %q", lossless[12:16])
+	}
+	if len(low) >= len(high) || len(low) >= len(lossless) {
+		t.Fatalf("expected q1 smaller than q4 and lossless, got %d, %d, %d bytes", len(low), len(high), len(lossless))
+	}
+}
+
+func Test_ImageOperator_Fit(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		fit           string
+		width, height int
+	}{
+		{"", 300, 168},
+		{actor.ImageFitInside, 300, 168},
+		{actor.ImageFitOutside, 533, 300},
+		{actor.ImageFitCover, 300, 300},
+		{actor.ImageFitContain, 300, 300},
+		{actor.ImageFitPad, 300, 300},
+		{actor.ImageFitFill, 300, 300},
+	}
+	for _, tc := range cases {
+		t.Run("fit_"+tc.fit, func(t *testing.T) {
+			t.Parallel()
+			op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Width: 300, Height: 300, Fit: tc.fit, Enlarge: true})
+			if err := op.Decode(t.Context(), newTestPNGReader(t, 160, 90)); err != nil {
+				t.Fatal(err)
+			}
+			if err := op.Process(t.Context()); err != nil {
+				t.Fatal(err)
+			}
+			out, err := op.ImageByte(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, _, _ := image.DecodeConfig(bytes.NewReader(out))
+			if cfg.Width != tc.width || cfg.Height != tc.height {
+				t.Fatalf("fit %q: expected %dx%d, got %dx%d", tc.fit, tc.width, tc.height, cfg.Width, cfg.Height)
+			}
+		})
+	}
+}
+
+func Test_ImageOperator_Fit_PadBackground(t *testing.T) {
+	t.Parallel()
+
+	bg := color.NRGBA{R: 255, G: 0, B: 0, A: 255}
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Width: 100, Height: 100, Fit: actor.ImageFitContain, Background: bg})
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 100, 50)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	out, err := op.ImageByte(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(50, 5)); got != bg {
+		t.Fatalf("letterbox color = %v, want %v", got, bg)
+	}
+	if got := color.NRGBAModel.Convert(img.At(50, 50)); got == bg {
+		t.Fatal("center should be the source image")
+	}
+}
+
+func Test_ImageOperator_Fit_WithCropAndRotate(t *testing.T) {
+	t.Parallel()
+
+	for _, option := range []actor.ImageOperatorOption{
+		{Width: 40, Height: 40, Fit: actor.ImageFitCover, Crop: [4]int{0, 0, 80, 20}, Enlarge: true},
+		{Width: 40, Height: 40, Fit: actor.ImageFitCover, Rotate: actor.ImageRotateRight},
+	} {
+		op := actor.NewImageOperator("image/png", option)
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 100, 50)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		out, _ := op.ImageByte(t.Context())
+		cfg, _, _ := image.DecodeConfig(bytes.NewReader(out))
+		if cfg.Width != 40 || cfg.Height != 40 {
+			t.Fatalf("expected 40x40, got %dx%d", cfg.Width, cfg.Height)
+		}
+	}
+}
+
+func Test_ImageOperator_Fit_Invalid(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Width: 10, Height: 10, Fit: "invalid_value"})
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 40, 40)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err == nil {
+		t.Fatal("expected error for invalid fit, got nil")
+	}
+}
+
+func Test_ImageOperator_BMP_TIFF(t *testing.T) {
+	t.Parallel()
+
+	for _, option := range []actor.ImageOperatorOption{
+		{Width: 40, Format: actor.ImageFormatBmp},
+		{Width: 40, Format: actor.ImageFormatTiff},
+		{Width: 40, Format: actor.ImageFormatTiff, Compression: actor.ImageCompressionNone},
+	} {
+		op := actor.NewImageOperator("image/png", option)
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 80, 40)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		out, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatalf("ImageByte %s: %v", option.Format, err)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("decode %s output: %v", option.Format, err)
+		}
+		if format != option.Format || cfg.Width != 40 || cfg.Height != 20 {
+			t.Fatalf("expected 40x20 %s, got %dx%d %s", option.Format, cfg.Width, cfg.Height, format)
+		}
+		// the encoded image goes through the pipeline again as source
+		op2 := actor.NewImageOperator(actor.OutputContentType("", option), actor.ImageOperatorOption{Width: 20})
+		if err := op2.Decode(t.Context(), bytes.NewReader(out)); err != nil {
+			t.Fatalf("Decode %s: %v", option.Format, err)
+		}
+		if err := op2.Process(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := op2.ImageByte(t.Context()); err != nil {
+			t.Fatalf("ImageByte %s source: %v", option.Format, err)
+		}
+	}
+}
+
+func Test_ImageOperator_Compression_Invalid(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/tiff", actor.ImageOperatorOption{Compression: "lzw"})
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 10, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err == nil {
+		t.Fatal("expected error for invalid compression, got nil")
+	}
+}
+
 func itoa(n int) string {
 	if n == 0 {
 		return "0"
@@ -332,3 +608,723 @@ func itoa(n int) string {
 	}
 	return string(buf)
 }
+
+func newTestEdgePNGReader(t *testing.T, w, h int) *bytes.Reader {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			if x < w/2 {
+				img.Set(x, y, color.NRGBA{R: 60, G: 60, B: 60, A: 255})
+			} else {
+				img.Set(x, y, color.NRGBA{R: 200, G: 200, B: 200, A: 255})
+			}
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func Test_ImageOperator_BlurSharpen(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		option  actor.ImageOperatorOption
+		compare func(dark, bright uint8) bool
+	}{
+		"blur":            {actor.ImageOperatorOption{Blur: 2}, func(dark, bright uint8) bool { return dark > 60 && bright < 200 }},
+		"sharpen":         {actor.ImageOperatorOption{Sharpen: [3]float64{1.5}}, func(dark, bright uint8) bool { return dark < 60 && bright > 200 }},
+		"sharpen minimal": {actor.ImageOperatorOption{Sharpen: [3]float64{1.5, 1, 255}}, func(dark, bright uint8) bool { return dark == 60 && bright == 200 }},
+	}
+	for name, tt := range tests {
+		op := actor.NewImageOperator("image/png", tt.option)
+		if err := op.Decode(t.Context(), newTestEdgePNGReader(t, 40, 20)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatalf("%s: Process: %v", name, err)
+		}
+		b, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatalf("%s: ImageByte: %v", name, err)
+		}
+		img, err := png.Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != 40 || img.Bounds().Dy() != 20 {
+			t.Fatalf("%s: size = %v", name, img.Bounds())
+		}
+		dark, _, _, _ := img.At(19, 10).RGBA()
+		bright, _, _, _ := img.At(20, 10).RGBA()
+		if !tt.compare(uint8(dark>>8), uint8(bright>>8)) {
+			t.Errorf("%s: edge = %d / %d", name, dark>>8, bright>>8)
+		}
+	}
+}
+
+func Test_ImageOperator_ColorFilters(t *testing.T) {
+	t.Parallel()
+
+	// source pixel is (100, 150, 200)
+	tests := map[string]struct {
+		option actor.ImageOperatorOption
+		want   [3]int
+	}{
+		"grayscale":     {actor.ImageOperatorOption{Grayscale: true}, [3]int{143, 143, 143}},
+		"sat -100":      {actor.ImageOperatorOption{Saturation: -100}, [3]int{143, 143, 143}},
+		"sepia":         {actor.ImageOperatorOption{Sepia: 100}, [3]int{192, 171, 134}},
+		"hue 360":       {actor.ImageOperatorOption{HueRotate: 360}, [3]int{100, 150, 200}},
+		"invert":        {actor.ImageOperatorOption{Invert: true}, [3]int{155, 105, 55}},
+		"invert first":  {actor.ImageOperatorOption{Invert: true, ColorMatrix: [20]float64{0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0}}, [3]int{0, 105, 55}},
+		"matrix offset": {actor.ImageOperatorOption{ColorMatrix: [20]float64{1, 0, 0, 0, 0.2, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0}}, [3]int{151, 150, 0}},
+	}
+	for name, tt := range tests {
+		op := actor.NewImageOperator("image/png", tt.option)
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 10, 10)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatalf("%s: Process: %v", name, err)
+		}
+		b, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatalf("%s: ImageByte: %v", name, err)
+		}
+		img, err := png.Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, g, bl, _ := img.At(5, 5).RGBA()
+		got := [3]int{int(r >> 8), int(g >> 8), int(bl >> 8)}
+		for i := range got {
+			if diff := got[i] - tt.want[i]; diff < -1 || diff > 1 {
+				t.Errorf("%s: color = %v, want %v", name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func Test_ImageOperator_Watermark(t *testing.T) {
+	t.Parallel()
+
+	logo := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	for y := range 10 {
+		for x := range 10 {
+			logo.Set(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+		}
+	}
+	tests := map[string]struct {
+		option  actor.ImageOperatorOption
+		checkAt image.Point
+		want    [3]int
+	}{
+		"default south east":   {actor.ImageOperatorOption{Width: 40}, image.Pt(35, 35), [3]int{255, 255, 255}},
+		"outside of watermark": {actor.ImageOperatorOption{Width: 40}, image.Pt(5, 5), [3]int{100, 150, 200}},
+		"margin":               {actor.ImageOperatorOption{Width: 40, WatermarkMargin: 5}, image.Pt(37, 37), [3]int{100, 150, 200}},
+		"north west":           {actor.ImageOperatorOption{Width: 40, WatermarkPosition: actor.ImageGravityNorthWest}, image.Pt(5, 5), [3]int{255, 255, 255}},
+		"opacity":              {actor.ImageOperatorOption{Width: 40, WatermarkOpacity: 50}, image.Pt(35, 35), [3]int{178, 203, 228}},
+		"scale":                {actor.ImageOperatorOption{Width: 40, WatermarkScale: 0.5}, image.Pt(22, 22), [3]int{255, 255, 255}},
+	}
+	for name, tt := range tests {
+		op := actor.NewImageOperator("image/png", tt.option)
+		op.SetWatermark(logo)
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 80, 80)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatalf("%s: Process: %v", name, err)
+		}
+		b, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatalf("%s: ImageByte: %v", name, err)
+		}
+		img, err := png.Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, g, bl, _ := img.At(tt.checkAt.X, tt.checkAt.Y).RGBA()
+		got := [3]int{int(r >> 8), int(g >> 8), int(bl >> 8)}
+		for i := range got {
+			if diff := got[i] - tt.want[i]; diff < -1 || diff > 1 {
+				t.Errorf("%s: color = %v, want %v", name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func Test_ImageOperator_Watermark_InvalidPosition(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{WatermarkPosition: actor.ImageGravitySmart})
+	op.SetWatermark(image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 20, 20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err == nil {
+		t.Fatal("expected error for invalid watermark position, got nil")
+	}
+}
+
+func Test_DecodeWatermark(t *testing.T) {
+	t.Parallel()
+
+	watermark, err := actor.DecodeWatermark(newTestPNGReader(t, 12, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if watermark.Bounds() != image.Rect(0, 0, 12, 8) {
+		t.Fatalf("bounds = %v", watermark.Bounds())
+	}
+	if _, err := actor.DecodeWatermark(strings.NewReader("not-an-image")); err == nil {
+		t.Fatal("expected decode error, got nil")
+	}
+	if _, err := actor.DecodeWatermark(bytes.NewReader(newTestHugePNG(t))); !errors.Is(err, actor.ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func Test_ImageOperator_WatermarkScale_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, scale := range []float64{1.5, 1e12, -0.1} {
+		op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Width: 40, WatermarkScale: scale})
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 80, 80)); err != nil {
+			t.Fatal(err)
+		}
+		op.SetWatermark(image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+		if err := op.Process(t.Context()); err == nil {
+			t.Errorf("wmscale %v: expected error, got nil", scale)
+		}
+	}
+}
+
+func Test_ImageOperator_WatermarkScale_TooLarge(t *testing.T) {
+	t.Parallel()
+
+	// height of scaled watermark follows its aspect ratio beyond the output
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Width: 2000, Enlarge: true, WatermarkScale: 1})
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 20, 20)); err != nil {
+		t.Fatal(err)
+	}
+	op.SetWatermark(image.NewNRGBA(image.Rect(0, 0, 1, 100)))
+	if err := op.Process(t.Context()); !errors.Is(err, actor.ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func Test_ImageOperator_Text(t *testing.T) {
+	t.Parallel()
+
+	textfont, ok := actor.BundledFont("gobold")
+	if !ok {
+		t.Fatal("bundled font not found")
+	}
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{
+		Text:            "SOLD",
+		TextSize:        20,
+		TextColor:       color.NRGBA{A: 255},
+		TextStroke:      1,
+		TextPosition:    actor.ImageGravityNorthWest,
+		TextBackground:  color.NRGBA{R: 255, A: 255},
+		TextStrokeColor: color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+	})
+	op.SetFont(textfont)
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 120, 60)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	b, err := op.ImageByte(t.Context())
+	if err != nil {
+		t.Fatalf("ImageByte: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, _, _ := img.At(1, 1).RGBA(); r>>8 != 255 || g>>8 != 0 {
+		t.Fatalf("background box pixel = %v", img.At(1, 1))
+	}
+	if r, g, bl, _ := img.At(110, 50).RGBA(); r>>8 != 100 || g>>8 != 150 || bl>>8 != 200 {
+		t.Fatalf("pixel outside of text = %v", img.At(110, 50))
+	}
+	var black, white int
+	for y := range 40 {
+		for x := range 80 {
+			switch r, g, bl, _ := img.At(x, y).RGBA(); {
+			case r>>8 < 30 && g>>8 < 30 && bl>>8 < 30:
+				black++
+			case r>>8 > 225 && g>>8 > 225 && bl>>8 > 225:
+				white++
+			}
+		}
+	}
+	if black == 0 || white == 0 {
+		t.Fatalf("text and stroke should be drawn: black %d / white %d", black, white)
+	}
+}
+
+func Test_ImageOperator_Text_SizeToHeight(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Text: strings.Repeat("W", 50), TextSize: 1000, TextStroke: 20})
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 400, 40)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatalf("text larger than image should be scaled to its height: %v", err)
+	}
+}
+
+func Test_ImageOperator_Text_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for name, option := range map[string]actor.ImageOperatorOption{
+		"position": {Text: "SOLD", TextPosition: actor.ImageGravitySmart},
+		"length":   {Text: strings.Repeat("a", 257)},
+		"area":     {Text: strings.Repeat("W", 256), TextSize: 1000, TextStroke: 20},
+	} {
+		op := actor.NewImageOperator("image/png", option)
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 20, 2000)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err == nil {
+			t.Fatalf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func newTestTransparentPNGReader(t *testing.T, w, h int) *bytes.Reader {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := w / 2; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: 0, G: 0, B: 255, A: 255})
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func Test_ImageOperator_FlattenJPEG(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		option actor.ImageOperatorOption
+		want   [3]int
+	}{
+		"default white":  {actor.ImageOperatorOption{Format: actor.ImageFormatJpeg}, [3]int{255, 255, 255}},
+		"bg":             {actor.ImageOperatorOption{Format: actor.ImageFormatJpeg, Background: color.NRGBA{R: 255, A: 255}}, [3]int{255, 0, 0}},
+		"translucent bg": {actor.ImageOperatorOption{Format: actor.ImageFormatJpeg, Background: color.NRGBA{A: 128}}, [3]int{127, 127, 127}},
+		"pad":            {actor.ImageOperatorOption{Format: actor.ImageFormatJpeg, Width: 40, Height: 80, Fit: actor.ImageFitPad}, [3]int{255, 255, 255}},
+	}
+	for name, tt := range tests {
+		op := actor.NewImageOperator("image/png", tt.option)
+		if err := op.Decode(t.Context(), newTestTransparentPNGReader(t, 40, 40)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatalf("%s: Process: %v", name, err)
+		}
+		b, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatalf("%s: ImageByte: %v", name, err)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, g, bl, _ := img.At(2, 2).RGBA()
+		got := [3]int{int(r >> 8), int(g >> 8), int(bl >> 8)}
+		for i := range got {
+			if diff := got[i] - tt.want[i]; diff < -4 || diff > 4 {
+				t.Errorf("%s: color = %v, want %v", name, got, tt.want)
+				break
+			}
+		}
+		// opaque half keeps its color
+		if _, _, bl, _ := img.At(img.Bounds().Dx()-3, img.Bounds().Dy()/2).RGBA(); bl>>8 < 200 {
+			t.Errorf("%s: opaque pixel = %v", name, img.At(img.Bounds().Dx()-3, img.Bounds().Dy()/2))
+		}
+	}
+}
+
+func Test_ImageOperator_KeepAlphaPNG(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Width: 20, Background: color.NRGBA{R: 255, A: 255}})
+	if err := op.Decode(t.Context(), newTestTransparentPNGReader(t, 40, 40)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := op.ImageByte(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := img.At(1, 1).RGBA(); a != 0 {
+		t.Fatalf("png should keep transparency, alpha = %d", a)
+	}
+}
+
+func Test_ImageOperator_Radius(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		radius string
+		alpha  map[image.Point]uint32
+	}{
+		"px":  {"10", map[image.Point]uint32{{1, 1}: 0, {5, 5}: 255, {38, 1}: 0, {20, 0}: 255, {38, 38}: 0}},
+		"max": {actor.ImageRadiusMax, map[image.Point]uint32{{5, 5}: 0, {20, 2}: 255, {20, 20}: 255, {2, 20}: 255, {34, 34}: 0}},
+	}
+	for name, tt := range tests {
+		op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Radius: tt.radius})
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 40, 40)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatalf("%s: Process: %v", name, err)
+		}
+		b, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatalf("%s: ImageByte: %v", name, err)
+		}
+		img, err := png.Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for pt, want := range tt.alpha {
+			if _, _, _, a := img.At(pt.X, pt.Y).RGBA(); a>>8 != want {
+				t.Errorf("%s: alpha at %v = %d, want %d", name, pt, a>>8, want)
+			}
+		}
+	}
+}
+
+func Test_ImageOperator_Radius_JPEGBackground(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{
+		Radius:     actor.ImageRadiusMax,
+		Format:     actor.ImageFormatJpeg,
+		Background: color.NRGBA{R: 255, A: 255},
+	})
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 40, 40)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := op.ImageByte(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, _, _ := img.At(1, 1).RGBA(); r>>8 < 240 || g>>8 > 15 {
+		t.Fatalf("masked corner should be bg, got %v", img.At(1, 1))
+	}
+}
+
+func Test_ImageOperator_Radius_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, radius := range []string{"-3", "round"} {
+		op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Radius: radius})
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 20, 20)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err == nil {
+			t.Fatalf("radius %q: expected error, got nil", radius)
+		}
+	}
+}
+
+func Test_ImageOperator_Trim(t *testing.T) {
+	t.Parallel()
+
+	bordered := image.NewNRGBA(image.Rect(0, 0, 60, 40))
+	draw.Draw(bordered, bordered.Bounds(), image.NewUniform(color.NRGBA{R: 250, G: 250, B: 250, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(bordered, image.Rect(10, 5, 40, 25), image.NewUniform(color.NRGBA{R: 200, A: 255}), image.Point{}, draw.Src)
+	bordered.Set(0, 39, color.NRGBA{R: 245, G: 245, B: 245, A: 255})
+	transparent := image.NewNRGBA(image.Rect(0, 0, 30, 30))
+	draw.Draw(transparent, image.Rect(5, 8, 15, 12), image.NewUniform(color.NRGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+	uniform := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+
+	tests := map[string]struct {
+		src  image.Image
+		want image.Rectangle
+	}{
+		"bordered":    {bordered, image.Rect(10, 5, 40, 25)},
+		"transparent": {transparent, image.Rect(5, 8, 15, 12)},
+		"uniform":     {uniform, image.Rect(0, 0, 20, 20)},
+	}
+	for name, tt := range tests {
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, tt.src); err != nil {
+			t.Fatal(err)
+		}
+		op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Trim: 10})
+		if err := op.Decode(t.Context(), bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatalf("%s: Process: %v", name, err)
+		}
+		if got := op.TrimBox(); got != tt.want {
+			t.Errorf("%s: TrimBox = %v, want %v", name, got, tt.want)
+		}
+		b, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Size() != tt.want.Size() {
+			t.Errorf("%s: size = %v, want %v", name, img.Bounds().Size(), tt.want.Size())
+		}
+	}
+}
+
+func Test_ImageOperator_Trim_BeforeResize(t *testing.T) {
+	t.Parallel()
+
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(30, 20, 70, 40), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err)
+	}
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Trim: 1, Width: 20})
+	if err := op.Decode(t.Context(), bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := op.ImageByte(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 10 {
+		t.Fatalf("size = %v, want 20x10", img.Bounds().Size())
+	}
+}
+
+func Test_ImageOperator_Trim_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, trim := range []int{-1, 256} {
+		op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Trim: trim})
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 20, 20)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err == nil {
+			t.Fatalf("trim %d: expected error, got nil", trim)
+		}
+	}
+}
+
+func Test_ImageOperator_Dpr(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		option        actor.ImageOperatorOption
+		width, height int
+	}{
+		"width":         {actor.ImageOperatorOption{Width: 100, Dpr: 2}, 200, 100},
+		"fraction":      {actor.ImageOperatorOption{Width: 100, Dpr: 1.5}, 150, 75},
+		"capped":        {actor.ImageOperatorOption{Width: 150, Dpr: 4}, 400, 200},
+		"enlarge":       {actor.ImageOperatorOption{Width: 150, Dpr: 4, Enlarge: true}, 600, 300},
+		"beyond origin": {actor.ImageOperatorOption{Width: 500, Dpr: 2}, 400, 200},
+		"cover":         {actor.ImageOperatorOption{Width: 100, Height: 100, Fit: actor.ImageFitCover, Dpr: 3}, 200, 200},
+		"crop":          {actor.ImageOperatorOption{Width: 50, Crop: [4]int{0, 0, 200, 100}, Dpr: 3}, 150, 75},
+	}
+	for name, tt := range tests {
+		op := actor.NewImageOperator("image/png", tt.option)
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 400, 200)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatalf("%s: Process: %v", name, err)
+		}
+		out, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, _, _ := image.DecodeConfig(bytes.NewReader(out))
+		if cfg.Width != tt.width || cfg.Height != tt.height {
+			t.Errorf("%s: expected %dx%d, got %dx%d", name, tt.width, tt.height, cfg.Width, cfg.Height)
+		}
+	}
+}
+
+func Test_ImageOperator_Dpr_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, dpr := range []float64{0.5, 4.5, -1} {
+		op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Width: 10, Dpr: dpr})
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 20, 20)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err == nil {
+			t.Fatalf("dpr %v: expected error, got nil", dpr)
+		}
+	}
+}
+
+func Test_ImageOperator_FloatOption_NotFinite(t *testing.T) {
+	t.Parallel()
+
+	nan, inf := math.NaN(), math.Inf(1)
+	tests := map[string]actor.ImageOperatorOption{
+		"dpr":         {Width: 10, Dpr: nan},
+		"gamma":       {Gamma: inf},
+		"blur":        {Blur: nan},
+		"sharpen":     {Sharpen: [3]float64{1, nan, 0}},
+		"focal point": {Width: 10, Height: 10, FocalPoint: [2]float64{nan, 0.5}},
+		"color matrix": {ColorMatrix: [20]float64{
+			1, 0, 0, 0, 0,
+			0, 1, 0, 0, 0,
+			0, 0, 1, 0, 0,
+			0, 0, 0, 1, inf,
+		}},
+		"watermark scale": {WatermarkScale: -inf},
+		"text size":       {Text: "a", TextSize: nan},
+	}
+	for name, option := range tests {
+		op := actor.NewImageOperator("image/png", option)
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 20, 20)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func Test_ImageOperator_Enlarge(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		option        actor.ImageOperatorOption
+		width, height int
+	}{
+		"inside":          {actor.ImageOperatorOption{Width: 20000}, 100, 50},
+		"inside enlarge":  {actor.ImageOperatorOption{Width: 300, Enlarge: true}, 300, 150},
+		"cover":           {actor.ImageOperatorOption{Width: 80, Height: 80, Fit: actor.ImageFitCover}, 50, 50},
+		"cover aspect":    {actor.ImageOperatorOption{Width: 200, Height: 50, Fit: actor.ImageFitCover}, 100, 25},
+		"pad":             {actor.ImageOperatorOption{Width: 200, Height: 200, Fit: actor.ImageFitPad}, 200, 200},
+		"fill":            {actor.ImageOperatorOption{Width: 200, Height: 100, Fit: actor.ImageFitFill}, 100, 50},
+		"crop":            {actor.ImageOperatorOption{Width: 100, Crop: [4]int{0, 0, 40, 20}}, 40, 20},
+		"downscale as is": {actor.ImageOperatorOption{Width: 50}, 50, 25},
+	}
+	for name, tt := range tests {
+		op := actor.NewImageOperator("image/png", tt.option)
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 100, 50)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); err != nil {
+			t.Fatalf("%s: Process: %v", name, err)
+		}
+		out, err := op.ImageByte(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, _, _ := image.DecodeConfig(bytes.NewReader(out))
+		if cfg.Width != tt.width || cfg.Height != tt.height {
+			t.Errorf("%s: expected %dx%d, got %dx%d", name, tt.width, tt.height, cfg.Width, cfg.Height)
+		}
+	}
+}
+
+func Test_ImageOperator_OutputSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	for name, option := range map[string]actor.ImageOperatorOption{
+		"dimension":  {Width: 20000, Enlarge: true},
+		"megapixels": {Width: 9000, Height: 9000, Fit: actor.ImageFitFill, Enlarge: true},
+		"pad canvas": {Width: 20000, Height: 20000, Fit: actor.ImageFitPad},
+	} {
+		op := actor.NewImageOperator("image/png", option)
+		if err := op.Decode(t.Context(), newTestPNGReader(t, 100, 50)); err != nil {
+			t.Fatal(err)
+		}
+		if err := op.Process(t.Context()); !errors.Is(err, actor.ErrImageTooLarge) {
+			t.Errorf("%s: expected ErrImageTooLarge, got %v", name, err)
+		}
+	}
+}
+
+func Test_ImageOperator_OutputWithinSource(t *testing.T) {
+	t.Parallel()
+
+	// source wider than max dimension of output is processed as long as output does not grow
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Brightness: 10})
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 11000, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+}
+
+func Test_ImageOperator_RotateAngle_TooLarge(t *testing.T) {
+	t.Parallel()
+
+	// output is small, but expanded canvas of rotation exceeds max dimension
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Width: 100, Rotate: "1"})
+	if err := op.Decode(t.Context(), newTestPNGReader(t, 12000, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Process(t.Context()); !errors.Is(err, actor.ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+// newTestHugePNG rewrites IHDR of 1x1 png to claim 20000x20000 without allocating it.
+func newTestHugePNG(t *testing.T) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[16:20], 20000)
+	binary.BigEndian.PutUint32(b[20:24], 20000)
+	binary.BigEndian.PutUint32(b[29:33], crc32.ChecksumIEEE(b[12:29]))
+	return b
+}
+
+func Test_ImageOperator_Decode_SourceTooLarge(t *testing.T) {
+	t.Parallel()
+
+	op := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Width: 10})
+	if err := op.Decode(t.Context(), bytes.NewReader(newTestHugePNG(t))); !errors.Is(err, actor.ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package actor
+
+import (
+	"errors"
+	"image"
+	"math"
+	"strconv"
+
+	"github.com/howood/imagereductor/library/utils"
+	"golang.org/x/image/draw"
+)
+
+// cornerRadius returns radius of corners for width x height image.
+// max is half of the shorter side so square image becomes circle.
+//
+//nolint:mnd
+func (im *imageCreator) cornerRadius(width, height int) (float64, error) {
+	if im.option.Radius == "" {
+		return 0, nil
+	}
+	if im.option.Radius == ImageRadiusMax {
+		return float64(min(width, height)) / 2, nil
+	}
+	radius, err := strconv.Atoi(im.option.Radius)
+	if err != nil || radius < 0 {
+		//nolint:err113
+		return 0, errors.New("invalid Radius Parameter")
+	}
+	return math.Min(float64(radius), float64(min(width, height))/2), nil
+}
+
+// roundCorners masks corners of image transparent with anti-aliased edges.
+//
+//nolint:mnd
+func (im *imageCreator) roundCorners(src image.Image) image.Image {
+	bounds := src.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+	radius, err := im.cornerRadius(width, height)
+	if err != nil || radius <= 0 {
+		return src
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	utils.ApplyParallel(0, height, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := range width {
+				// distance from pixel center to the center of corner circle
+				cx := math.Max(radius-(float64(x)+0.5), (float64(x)+0.5)-(float64(width)-radius))
+				cy := math.Max(radius-(float64(y)+0.5), (float64(y)+0.5)-(float64(height)-radius))
+				if cx <= 0 || cy <= 0 {
+					continue
+				}
+				coverage := utils.InRanged(radius-math.Hypot(cx, cy)+0.5, 0, 1)
+				pos := y*dst.Stride + x*4 + 3
+				dst.Pix[pos] = uint8(math.Round(float64(dst.Pix[pos]) * coverage))
+			}
+		}
+	})
+	return dst
+}
@@ -0,0 +1,96 @@
+package actor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/howood/imagereductor/library/utils"
+)
+
+// ErrImageTooLarge is returned when image size exceeds the limit of server.
+var ErrImageTooLarge = errors.New("image size exceeds limit")
+
+const (
+	// defaultMaxOutputDimension is default max width and height of output.
+	defaultMaxOutputDimension = 10000
+	// defaultMaxOutputMegapixels is default max megapixels of output.
+	defaultMaxOutputMegapixels = 50
+	// defaultMaxSourceMegapixels is default max megapixels of source.
+	defaultMaxSourceMegapixels = 100
+	megapixel                  = 1000000
+)
+
+// validateSourceSize checks pixels of source from its header before decoding whole image and returns its format.
+// Each frame of gif is composited onto the logical screen, so gif is limited by the screen times the number of frames.
+func (im *imageCreator) validateSourceSize(src io.ReadSeeker) (string, error) {
+	config, format, err := image.DecodeConfig(src)
+	if err != nil {
+		return "", err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	frames := 1
+	if format == "gif" {
+		if frames, err = countGifFrames(src); err != nil {
+			return "", err
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+	if err := validateSourcePixels(config.Width, config.Height, frames); err != nil {
+		return "", err
+	}
+	return format, nil
+}
+
+// validateSourcePixels checks pixels of all frames of source against max megapixels of server.
+func validateSourcePixels(width, height, frames int) error {
+	maxMegapixels := utils.GetOsEnvInt("SOURCE_MAX_MEGAPIXELS", defaultMaxSourceMegapixels)
+	if width*height*frames > maxMegapixels*megapixel {
+		return fmt.Errorf("%w: source %dx%d of %d frames exceeds %d megapixels", ErrImageTooLarge, width, height, frames, maxMegapixels)
+	}
+	return nil
+}
+
+// shrinkToOrigin scales down resized size keeping its aspect ratio so that output never exceeds origin.
+func (im *imageCreator) shrinkToOrigin(originx, originy int) {
+	if im.object.DstX <= originx && im.object.DstY <= originy {
+		return
+	}
+	ratio := math.Min(float64(originx)/float64(im.object.DstX), float64(originy)/float64(im.object.DstY))
+	im.object.DstX = max(1, int(math.Round(float64(im.object.DstX)*ratio)))
+	im.object.DstY = max(1, int(math.Round(float64(im.object.DstY)*ratio)))
+}
+
+// validateOutputSize checks resized size and padded canvas against max dimension and megapixels of server
+// before allocating them. Megapixels of animation are counted over all of its frames.
+// Output not growing beyond origin is bounded by the source limit already, so it is not checked.
+func (im *imageCreator) validateOutputSize() error {
+	width, height := im.object.DstX, im.object.DstY
+	if im.option.Fit == ImageFitContain || im.option.Fit == ImageFitPad {
+		width, height = max(width, im.object.BoxX), max(height, im.object.BoxY)
+	}
+	if width <= im.object.OriginX && height <= im.object.OriginY {
+		return nil
+	}
+	return validateOutputPixels(width, height, max(1, len(im.object.SourceFrames)))
+}
+
+// validateOutputPixels checks width and height of output against max dimension of server
+// and pixels of all frames against max megapixels of server.
+func validateOutputPixels(width, height, frames int) error {
+	maxDimension := utils.GetOsEnvInt("OUTPUT_MAX_DIMENSION", defaultMaxOutputDimension)
+	if width > maxDimension || height > maxDimension {
+		return fmt.Errorf("%w: %dx%d exceeds max dimension %d", ErrImageTooLarge, width, height, maxDimension)
+	}
+	maxMegapixels := utils.GetOsEnvInt("OUTPUT_MAX_MEGAPIXELS", defaultMaxOutputMegapixels)
+	if width*height*frames > maxMegapixels*megapixel {
+		return fmt.Errorf("%w: %dx%d of %d frames exceeds %d megapixels", ErrImageTooLarge, width, height, frames, maxMegapixels)
+	}
+	return nil
+}
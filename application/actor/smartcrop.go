@@ -0,0 +1,170 @@
+package actor
+
+import (
+	"image"
+	"math"
+
+	"github.com/howood/imagereductor/library/utils"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// smartCropAnalysisSize is max size of the image to score.
+	smartCropAnalysisSize = 256
+	// smartCropDetailWeight is weight of edge energy.
+	smartCropDetailWeight = 0.2
+	// smartCropSkinWeight is weight of skin tone.
+	smartCropSkinWeight = 1.8
+	// smartCropSaturationWeight is weight of saturation.
+	smartCropSaturationWeight = 0.1
+	// smartCropSkinThreshold is min similarity to skin color.
+	smartCropSkinThreshold = 0.8
+	// smartCropSaturationThreshold is min saturation.
+	smartCropSaturationThreshold = 0.4
+	// smartCropScoreScale keeps decimals of pixel scores summed as integers.
+	smartCropScoreScale = 16
+)
+
+// smartCropSkinColor is normalized rgb vector of skin tone.
+//
+//nolint:gochecknoglobals
+var smartCropSkinColor = [3]float64{0.78, 0.57, 0.44}
+
+// smartCropOffset returns top left point of width x height window with the most salient content in src.
+// Scores are summed as integers so the same image always gives the same window.
+func (im *imageCreator) smartCropOffset(src image.Image, width, height int) image.Point {
+	bounds := src.Bounds()
+	overX := max(bounds.Dx()-width, 0)
+	overY := max(bounds.Dy()-height, 0)
+	if overX == 0 && overY == 0 {
+		return image.Point{}
+	}
+	ratio := math.Min(1, smartCropAnalysisSize/float64(max(bounds.Dx(), bounds.Dy())))
+	analysisX := max(1, int(float64(bounds.Dx())*ratio))
+	analysisY := max(1, int(float64(bounds.Dy())*ratio))
+	analysis := image.NewNRGBA(image.Rect(0, 0, analysisX, analysisY))
+	draw.ApproxBiLinear.Scale(analysis, analysis.Bounds(), src, bounds, draw.Src, nil)
+
+	integral := im.summedArea(im.smartCropScores(analysis), analysisX, analysisY)
+	windowX := min(analysisX, max(1, int(math.Round(float64(width)*ratio))))
+	windowY := min(analysisY, max(1, int(math.Round(float64(height)*ratio))))
+	// start from center so flat images keep the center crop
+	//nolint:mnd
+	best := image.Pt((analysisX-windowX)/2, (analysisY-windowY)/2)
+	bestScore := im.smartCropWindowScore(integral, analysisX, best, windowX, windowY)
+	for y := 0; y <= analysisY-windowY; y++ {
+		for x := 0; x <= analysisX-windowX; x++ {
+			if score := im.smartCropWindowScore(integral, analysisX, image.Pt(x, y), windowX, windowY); score > bestScore {
+				best = image.Pt(x, y)
+				bestScore = score
+			}
+		}
+	}
+	return image.Pt(min(int(float64(best.X)/ratio), overX), min(int(float64(best.Y)/ratio), overY))
+}
+
+// smartCropScores scores each pixel by edge energy, skin tone and saturation.
+//
+//nolint:mnd
+func (im *imageCreator) smartCropScores(src *image.NRGBA) []int64 {
+	width := src.Bounds().Dx()
+	height := src.Bounds().Dy()
+	lightness := make([]float64, width*height)
+	utils.ApplyParallel(0, height, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := range width {
+				pos := y*src.Stride + x*4
+				lightness[y*width+x] = (0.2126*float64(src.Pix[pos]) + 0.7152*float64(src.Pix[pos+1]) + 0.0722*float64(src.Pix[pos+2])) / 255
+			}
+		}
+	})
+	scores := make([]int64, width*height)
+	utils.ApplyParallel(0, height, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := range width {
+				pos := y*src.Stride + x*4
+				r := float64(src.Pix[pos]) / 255
+				g := float64(src.Pix[pos+1]) / 255
+				b := float64(src.Pix[pos+2]) / 255
+				alpha := float64(src.Pix[pos+3]) / 255
+				light := lightness[y*width+x]
+				edge := math.Abs(4*light-
+					lightness[y*width+max(x-1, 0)]-
+					lightness[y*width+min(x+1, width-1)]-
+					lightness[max(y-1, 0)*width+x]-
+					lightness[min(y+1, height-1)*width+x]) * 255
+				score := edge*smartCropDetailWeight +
+					smartCropSkinScore(r, g, b, light)*smartCropSkinWeight +
+					smartCropSaturationScore(r, g, b, light)*smartCropSaturationWeight
+				scores[y*width+x] = int64(math.Round(score * alpha * smartCropScoreScale))
+			}
+		}
+	})
+	return scores
+}
+
+// summedArea builds summed area table with one padding row and column.
+func (im *imageCreator) summedArea(scores []int64, width, height int) []int64 {
+	integral := make([]int64, (width+1)*(height+1))
+	for y := range height {
+		var row int64
+		for x := range width {
+			row += scores[y*width+x]
+			integral[(y+1)*(width+1)+x+1] = integral[y*(width+1)+x+1] + row
+		}
+	}
+	return integral
+}
+
+// smartCropWindowScore sums the window plus its inner half again so subjects are kept away from the edges.
+//
+//nolint:mnd
+func (im *imageCreator) smartCropWindowScore(integral []int64, width int, pt image.Point, windowX, windowY int) int64 {
+	sum := func(rect image.Rectangle) int64 {
+		stride := width + 1
+		return integral[rect.Max.Y*stride+rect.Max.X] -
+			integral[rect.Min.Y*stride+rect.Max.X] -
+			integral[rect.Max.Y*stride+rect.Min.X] +
+			integral[rect.Min.Y*stride+rect.Min.X]
+	}
+	window := image.Rect(pt.X, pt.Y, pt.X+windowX, pt.Y+windowY)
+	inner := image.Rect(pt.X+windowX/4, pt.Y+windowY/4, pt.X+windowX-windowX/4, pt.Y+windowY-windowY/4)
+	return sum(window) + sum(inner)
+}
+
+// smartCropSkinScore scores similarity to skin tone.
+//
+//nolint:mnd
+func smartCropSkinScore(r, g, b, lightness float64) float64 {
+	mag := math.Sqrt(r*r + g*g + b*b)
+	if mag == 0 || lightness < 0.2 {
+		return 0
+	}
+	rd := r/mag - smartCropSkinColor[0]
+	gd := g/mag - smartCropSkinColor[1]
+	bd := b/mag - smartCropSkinColor[2]
+	skin := 1 - math.Sqrt(rd*rd+gd*gd+bd*bd)
+	if skin <= smartCropSkinThreshold {
+		return 0
+	}
+	return (skin - smartCropSkinThreshold) * (255 / (1 - smartCropSkinThreshold))
+}
+
+// smartCropSaturationScore scores saturation of not too dark or bright pixel.
+//
+//nolint:mnd
+func smartCropSaturationScore(r, g, b, lightness float64) float64 {
+	maximum := max(r, g, b)
+	minimum := min(r, g, b)
+	if maximum == minimum || lightness < 0.05 || lightness > 0.9 {
+		return 0
+	}
+	saturation := (maximum - minimum) / (maximum + minimum)
+	if (maximum+minimum)/2 > 0.5 {
+		saturation = (maximum - minimum) / (2 - maximum - minimum)
+	}
+	if saturation <= smartCropSaturationThreshold {
+		return 0
+	}
+	return (saturation - smartCropSaturationThreshold) * (255 / (1 - smartCropSaturationThreshold))
+}
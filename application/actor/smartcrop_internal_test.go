@@ -0,0 +1,112 @@
+package actor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func newSmartCropScene(width, height int, fill func(x, y int) color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetNRGBA(x, y, fill(x, y))
+		}
+	}
+	return img
+}
+
+func Test_SmartCropOffset_Golden(t *testing.T) {
+	t.Parallel()
+
+	gray := color.NRGBA{R: 128, G: 128, B: 128, A: 255}
+	cases := []struct {
+		name          string
+		src           *image.NRGBA
+		width, height int
+		want          image.Point
+	}{
+		{
+			name: "flat keeps center",
+			src: newSmartCropScene(200, 100, func(_, _ int) color.NRGBA {
+				return gray
+			}),
+			width: 100, height: 100,
+			want: image.Pt(50, 0),
+		},
+		{
+			name: "detail on the right",
+			src: newSmartCropScene(300, 100, func(x, y int) color.NRGBA {
+				if x >= 220 && x < 260 && y >= 30 && y < 70 && (x/4+y/4)%2 == 0 {
+					return color.NRGBA{A: 255}
+				}
+				return gray
+			}),
+			width: 100, height: 100,
+			want: image.Pt(186, 0),
+		},
+		{
+			name: "skin tone on the left",
+			src: newSmartCropScene(300, 100, func(x, y int) color.NRGBA {
+				if x >= 20 && x < 70 && y >= 20 && y < 80 {
+					return color.NRGBA{R: 224, G: 172, B: 138, A: 255}
+				}
+				return gray
+			}),
+			width: 100, height: 100,
+			want: image.Pt(0, 0),
+		},
+		{
+			name: "saturated subject at the bottom",
+			src: newSmartCropScene(100, 300, func(x, y int) color.NRGBA {
+				if x >= 30 && x < 70 && y >= 230 && y < 280 {
+					return color.NRGBA{R: 20, G: 40, B: 220, A: 255}
+				}
+				return gray
+			}),
+			width: 100, height: 100,
+			want: image.Pt(0, 200),
+		},
+	}
+	for _, tc := range cases {
+		im := newImageCreator("image/png", ImageOperatorOption{Gravity: ImageGravitySmart}, 0)
+		got := im.smartCropOffset(tc.src, tc.width, tc.height)
+		if got != tc.want {
+			t.Errorf("%s: offset = %v, want %v", tc.name, got, tc.want)
+		}
+		if again := im.smartCropOffset(tc.src, tc.width, tc.height); again != got {
+			t.Errorf("%s: not deterministic, %v then %v", tc.name, got, again)
+		}
+	}
+}
+
+func Test_Process_GravitySmart(t *testing.T) {
+	t.Parallel()
+
+	src := newSmartCropScene(300, 100, func(x, y int) color.NRGBA {
+		if x >= 220 && x < 260 && y >= 30 && y < 70 && (x/4+y/4)%2 == 0 {
+			return color.NRGBA{A: 255}
+		}
+		return color.NRGBA{R: 128, G: 128, B: 128, A: 255}
+	})
+	im := newImageCreator("image/png", ImageOperatorOption{Width: 50, Height: 50, Fit: ImageFitCover, Gravity: ImageGravitySmart}, 0)
+	im.object.Source = src
+	im.object.OriginX, im.object.OriginY = 300, 100
+	if err := im.Process(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if b := im.object.Dst.Bounds(); b.Dx() != 50 || b.Dy() != 50 {
+		t.Fatalf("expected 50x50, got %v", b)
+	}
+	dark := 0
+	for y := range 50 {
+		for x := range 50 {
+			if r, _, _, _ := im.object.Dst.At(x, y).RGBA(); r < 0x4000 {
+				dark++
+			}
+		}
+	}
+	if dark == 0 {
+		t.Fatal("expected the detailed region to be kept")
+	}
+}
@@ -0,0 +1,229 @@
+package actor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// defaultTextSize is font size of text overlay in px.
+	defaultTextSize = 24.0
+	// maxTextSize is max font size of text overlay in px.
+	maxTextSize = 1000.0
+	// maxTextStroke is max stroke width of text overlay in px.
+	maxTextStroke = 20
+	// maxTextMegapixels is max megapixels of rendered text including its stroke.
+	maxTextMegapixels = 16
+)
+
+// bundledFontFiles is ttf of fonts bundled with binary.
+//
+//nolint:gochecknoglobals
+var bundledFontFiles = map[string][]byte{
+	"goregular": goregular.TTF,
+	"gobold":    gobold.TTF,
+	"gomono":    gomono.TTF,
+}
+
+// bundledFonts is parsed bundled fonts.
+//
+//nolint:gochecknoglobals
+var bundledFonts sync.Map
+
+// ErrFontNotFound is returned when font is not found in font directory or storage.
+var ErrFontNotFound = errors.New("font not found")
+
+// FontCache keeps parsed fonts in memory.
+type FontCache struct {
+	cache *cache.Cache
+}
+
+// NewFontCache creates a new FontCache.
+func NewFontCache(expiration time.Duration) *FontCache {
+	return &FontCache{
+		cache: cache.New(expiration, expiration),
+	}
+}
+
+// Get returns parsed font of name.
+func (fc *FontCache) Get(name string) (*opentype.Font, bool) {
+	val, ok := fc.cache.Get(name)
+	if !ok {
+		return nil, false
+	}
+	textfont, ok := val.(*opentype.Font)
+	return textfont, ok
+}
+
+// Set puts parsed font of name.
+func (fc *FontCache) Set(name string, textfont *opentype.Font) {
+	fc.cache.SetDefault(name, textfont)
+}
+
+// BundledFont returns font bundled with binary.
+func BundledFont(name string) (*opentype.Font, bool) {
+	if textfont, ok := bundledFonts.Load(name); ok {
+		//nolint:forcetypeassert
+		return textfont.(*opentype.Font), true
+	}
+	ttf, ok := bundledFontFiles[name]
+	if !ok {
+		return nil, false
+	}
+	textfont, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, false
+	}
+	bundledFonts.Store(name, textfont)
+	return textfont, true
+}
+
+// ParseFont parses ttf or otf font.
+func ParseFont(src []byte) (*opentype.Font, error) {
+	return opentype.Parse(src)
+}
+
+// SetFont sets font of text overlay.
+func (im *imageCreator) SetFont(textfont *opentype.Font) {
+	im.object.Font = textfont
+}
+
+// overlayText draws text with stroke and background box by position and margin.
+// Text is limited to the height of image and its rendered area to maxTextMegapixels.
+//
+//nolint:mnd
+func (im *imageCreator) overlayText(src image.Image) (image.Image, error) {
+	textfont := im.object.Font
+	if textfont == nil {
+		textfont, _ = BundledFont("goregular")
+	}
+	bounds := src.Bounds()
+	size := defaultTextSize
+	if im.option.TextSize > 0 {
+		size = min(im.option.TextSize, maxTextSize)
+	}
+	size = max(1, min(size, float64(bounds.Dy())))
+	face, err := opentype.NewFace(textfont, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	stroke := min(max(im.option.TextStroke, 0), maxTextStroke)
+	padding := 0
+	if im.option.TextBackground.A > 0 {
+		padding = int(size / 4)
+	}
+	metrics := face.Metrics()
+	textWidth := font.MeasureString(face, im.option.Text).Ceil() + stroke*2
+	textHeight := (metrics.Ascent + metrics.Descent).Ceil() + stroke*2
+	if textWidth*textHeight > maxTextMegapixels*megapixel {
+		return nil, fmt.Errorf("%w: text %dx%d exceeds %d megapixels", ErrImageTooLarge, textWidth, textHeight, maxTextMegapixels)
+	}
+	boxWidth := textWidth + padding*2
+	boxHeight := textHeight + padding*2
+
+	position := im.option.TextPosition
+	if position == "" {
+		position = ImageGravityCenter
+	}
+	margin := im.option.TextMargin
+	offset := anchorOffset(position, bounds.Dx()-boxWidth-margin*2, bounds.Dy()-boxHeight-margin*2)
+	offset = bounds.Min.Add(offset).Add(image.Pt(margin, margin))
+
+	dst := image.NewNRGBA(bounds)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+	if im.option.TextBackground.A > 0 {
+		box := image.Rect(0, 0, boxWidth, boxHeight).Add(offset)
+		draw.Draw(dst, box, image.NewUniform(im.option.TextBackground), image.Point{}, draw.Over)
+	}
+	// glyphs are rasterized once into mask, and stroke is the mask dilated by its width
+	mask := image.NewAlpha(image.Rect(0, 0, textWidth, textHeight))
+	drawer := &font.Drawer{Dst: mask, Src: image.Opaque, Face: face}
+	drawer.Dot = fixed.P(stroke, stroke).Add(fixed.Point26_6{Y: metrics.Ascent})
+	drawer.DrawString(im.option.Text)
+	rect := mask.Bounds().Add(offset).Add(image.Pt(padding, padding))
+	if stroke > 0 {
+		draw.DrawMask(dst, rect, image.NewUniform(im.textStrokeColor()), image.Point{}, dilateAlpha(mask, stroke), image.Point{}, draw.Over)
+	}
+	draw.DrawMask(dst, rect, image.NewUniform(im.textColor()), image.Point{}, mask, image.Point{}, draw.Over)
+	return dst, nil
+}
+
+// dilateAlpha spreads alpha of mask over a disc of radius.
+// Each row is dilated horizontally by the half width of the disc at each vertical distance,
+// and the result is put onto the rows of that distance, so it costs area times radius.
+func dilateAlpha(mask *image.Alpha, radius int) *image.Alpha {
+	bounds := mask.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dst := image.NewAlpha(bounds)
+	halfWidths := make([]int, radius+1)
+	for dy := range halfWidths {
+		halfWidths[dy] = int(math.Sqrt(float64(radius*radius - dy*dy)))
+	}
+	// rows[w] is source row dilated horizontally by w
+	rows := make([][]uint8, radius+1)
+	for w := range rows {
+		rows[w] = make([]uint8, width)
+	}
+	for y := range height {
+		copy(rows[0], mask.Pix[y*mask.Stride:y*mask.Stride+width])
+		for w := 1; w <= radius; w++ {
+			prev, cur := rows[w-1], rows[w]
+			for x := range width {
+				v := prev[x]
+				if x > 0 {
+					v = max(v, prev[x-1])
+				}
+				if x < width-1 {
+					v = max(v, prev[x+1])
+				}
+				cur[x] = v
+			}
+		}
+		for dy := -radius; dy <= radius; dy++ {
+			ty := y + dy
+			if ty < 0 || ty >= height {
+				continue
+			}
+			row := rows[halfWidths[max(dy, -dy)]]
+			out := dst.Pix[ty*dst.Stride : ty*dst.Stride+width]
+			for x, v := range row {
+				out[x] = max(out[x], v)
+			}
+		}
+	}
+	return dst
+}
+
+// textColor returns text color, black by default.
+func (im *imageCreator) textColor() color.NRGBA {
+	if im.option.TextColor == (color.NRGBA{}) {
+		return color.NRGBA{A: 255}
+	}
+	return im.option.TextColor
+}
+
+// textStrokeColor returns text stroke color, white by default.
+//
+//nolint:mnd
+func (im *imageCreator) textStrokeColor() color.NRGBA {
+	if im.option.TextStrokeColor == (color.NRGBA{}) {
+		return color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	}
+	return im.option.TextStrokeColor
+}
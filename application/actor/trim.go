@@ -0,0 +1,85 @@
+package actor
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/howood/imagereductor/library/utils"
+	"golang.org/x/image/draw"
+)
+
+// trim removes borders of near uniform color of the top left pixel from source frames.
+// Trim box is detected on the first frame and applied to all frames of animation.
+func (im *imageCreator) trim() {
+	bounds := im.object.Source.Bounds()
+	box := im.trimBox(im.object.Source)
+	im.object.TrimBox = box.Sub(bounds.Min)
+	if box == bounds {
+		return
+	}
+	im.object.Source = im.rebase(im.object.Source, box)
+	for i, frame := range im.object.SourceFrames {
+		im.object.SourceFrames[i] = im.rebase(frame, box)
+	}
+	im.object.OriginX = box.Dx()
+	im.object.OriginY = box.Dy()
+}
+
+// rebase copies box of image to a new image whose origin is (0,0),
+// because the following processes like rotation assume the origin of source.
+func (im *imageCreator) rebase(src image.Image, box image.Rectangle) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, box.Dx(), box.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, box.Min, draw.Src)
+	return dst
+}
+
+// trimBox returns bounds of content whose color differs from the top left pixel by more than threshold.
+// Whole bounds is returned when image is uniform.
+//
+//nolint:mnd
+func (im *imageCreator) trimBox(src image.Image) image.Rectangle {
+	bounds := src.Bounds()
+	reference := color.RGBAModel.Convert(src.At(bounds.Min.X, bounds.Min.Y)).(color.RGBA) //nolint:forcetypeassert
+	threshold := im.option.Trim
+	// column range of content on each row, minX > maxX is a row without content
+	minX := make([]int, bounds.Dy())
+	maxX := make([]int, bounds.Dy())
+	utils.ApplyParallel(0, bounds.Dy(), func(start, end int) {
+		for row := start; row < end; row++ {
+			minX[row], maxX[row] = bounds.Max.X, bounds.Min.X-1
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if !im.isTrimColor(src.At(x, bounds.Min.Y+row), reference, threshold) {
+					minX[row] = min(minX[row], x)
+					maxX[row] = x
+				}
+			}
+		}
+	})
+	box := image.Rectangle{}
+	for row := range bounds.Dy() {
+		if minX[row] > maxX[row] {
+			continue
+		}
+		box = box.Union(image.Rect(minX[row], bounds.Min.Y+row, maxX[row]+1, bounds.Min.Y+row+1))
+	}
+	if box.Empty() {
+		return bounds
+	}
+	return box
+}
+
+// isTrimColor checks premultiplied color is within threshold of reference so any fully transparent pixels match.
+func (im *imageCreator) isTrimColor(c color.Color, reference color.RGBA, threshold int) bool {
+	rgba := color.RGBAModel.Convert(c).(color.RGBA) //nolint:forcetypeassert
+	diff := max(
+		absDiff(rgba.R, reference.R),
+		absDiff(rgba.G, reference.G),
+		absDiff(rgba.B, reference.B),
+		absDiff(rgba.A, reference.A),
+	)
+	return diff <= threshold
+}
+
+func absDiff(a, b uint8) int {
+	return max(int(a)-int(b), int(b)-int(a))
+}
@@ -0,0 +1,106 @@
+package actor
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"golang.org/x/image/draw"
+)
+
+// WatermarkCache keeps decoded watermark images in memory.
+type WatermarkCache struct {
+	cache *cache.Cache
+}
+
+// NewWatermarkCache creates a new WatermarkCache.
+func NewWatermarkCache(expiration time.Duration) *WatermarkCache {
+	return &WatermarkCache{
+		cache: cache.New(expiration, expiration),
+	}
+}
+
+// Get returns decoded watermark of storage key.
+//
+//nolint:ireturn
+func (wc *WatermarkCache) Get(key string) (image.Image, bool) {
+	val, ok := wc.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	watermark, ok := val.(image.Image)
+	return watermark, ok
+}
+
+// Set puts decoded watermark of storage key.
+func (wc *WatermarkCache) Set(key string, watermark image.Image) {
+	wc.cache.SetDefault(key, watermark)
+}
+
+// DecodeWatermark decodes watermark image checking its pixels from the header as well as source.
+//
+//nolint:ireturn
+func DecodeWatermark(src io.ReadSeeker) (image.Image, error) {
+	config, _, err := image.DecodeConfig(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSourcePixels(config.Width, config.Height, 1); err != nil {
+		return nil, err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	watermark, _, err := image.Decode(src)
+	if err != nil {
+		return nil, err
+	}
+	bounds := watermark.Bounds()
+	dst := image.NewNRGBA(bounds.Sub(bounds.Min))
+	draw.Draw(dst, dst.Bounds(), watermark, bounds.Min, draw.Src)
+	return dst, nil
+}
+
+// SetWatermark sets watermark image to overlay.
+func (im *imageCreator) SetWatermark(watermark image.Image) {
+	im.object.Watermark = watermark
+}
+
+// overlayWatermark composites watermark onto image by position, margin, opacity and scale.
+// Scaled watermark is checked against output limits before allocating, since its height follows the aspect ratio of watermark.
+//
+//nolint:mnd
+func (im *imageCreator) overlayWatermark(src image.Image) (image.Image, error) {
+	bounds := src.Bounds()
+	watermark := im.object.Watermark
+	if im.option.WatermarkScale > 0 {
+		wmbounds := watermark.Bounds()
+		width := max(1, int(math.Round(float64(bounds.Dx())*im.option.WatermarkScale)))
+		height := max(1, int(math.Round(float64(wmbounds.Dy())*float64(width)/float64(wmbounds.Dx()))))
+		if err := validateOutputPixels(width, height, 1); err != nil {
+			return nil, err
+		}
+		watermark = im.scale(watermark, image.Rect(0, 0, width, height), im.getDrawer())
+	}
+	position := im.option.WatermarkPosition
+	if position == "" {
+		position = ImageGravitySouthEast
+	}
+	wmbounds := watermark.Bounds()
+	margin := im.option.WatermarkMargin
+	offset := anchorOffset(position, bounds.Dx()-wmbounds.Dx()-margin*2, bounds.Dy()-wmbounds.Dy()-margin*2)
+	offset = bounds.Min.Add(offset).Add(image.Pt(margin, margin))
+
+	dst := image.NewNRGBA(bounds)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+	opacity := 100
+	if im.option.WatermarkOpacity > 0 {
+		opacity = min(im.option.WatermarkOpacity, 100)
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(opacity * 255 / 100)})
+	draw.DrawMask(dst, wmbounds.Sub(wmbounds.Min).Add(offset), watermark, wmbounds.Min, mask, image.Point{}, draw.Over)
+	return dst, nil
+}
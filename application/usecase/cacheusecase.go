@@ -6,6 +6,7 @@ import (
 
 	"github.com/howood/imagereductor/application/actor"
 	"github.com/howood/imagereductor/application/actor/cacheservice"
+	"github.com/howood/imagereductor/domain/entity"
 	"github.com/howood/imagereductor/domain/repository"
 	log "github.com/howood/imagereductor/infrastructure/logger"
 )
@@ -62,8 +63,14 @@ func (cu *CacheUsecase) GetCache(ctx context.Context, requesturi string) (bool,
 }
 
 func (cu *CacheUsecase) SetCache(ctx context.Context, mimetype string, data []byte, requesturi string, latsModified string) {
+	cu.SetCacheWithHeaders(ctx, mimetype, data, nil, requesturi, latsModified)
+}
+
+// SetCacheWithHeaders caches content with response headers to restore on cache hit.
+func (cu *CacheUsecase) SetCacheWithHeaders(ctx context.Context, mimetype string, data []byte, headers map[string]string, requesturi string, latsModified string) {
 	cachedresponse := actor.NewCachedContentOperator()
 	cachedresponse.Set(mimetype, latsModified, data)
+	cachedresponse.SetHeaders(headers)
 	encodedcached, err := cachedresponse.GobEncode()
 	if err != nil {
 		log.Error(ctx, err)
@@ -73,3 +80,8 @@ func (cu *CacheUsecase) SetCache(ctx context.Context, mimetype string, data []by
 		}
 	}
 }
+
+// CacheStats returns counters of cache when the cache type counts them.
+func (cu *CacheUsecase) CacheStats() (entity.CacheStats, bool) {
+	return cu.cacheAssessor.Stats()
+}
@@ -4,21 +4,51 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"image"
 	"io"
 	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
 
 	"github.com/howood/imagereductor/application/actor"
 	"github.com/howood/imagereductor/application/actor/storageservice"
 	"github.com/howood/imagereductor/domain/entity"
+	log "github.com/howood/imagereductor/infrastructure/logger"
 	"github.com/howood/imagereductor/library/utils"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/sync/singleflight"
 )
 
 // ErrReaderNotReadSeeker is returned when the reader does not implement io.ReadSeeker.
 var ErrReaderNotReadSeeker = errors.New("reader does not implement io.ReadSeeker")
 
+// ErrProcessingPanic is returned when image processing panics.
+var ErrProcessingPanic = errors.New("image processing panicked")
+
+// ErrInvalidFontName is returned when the font name contains path elements.
+var ErrInvalidFontName = errors.New("invalid font name")
+
+// imageResult is result of image or file shared by coalesced requests.
+type imageResult struct {
+	contenttype string
+	content     []byte
+	trimbox     image.Rectangle
+}
+
 type ImageUsecase struct {
-	cloudstorage *storageservice.CloudStorageAssessor
+	cloudstorage      *storageservice.CloudStorageAssessor
+	pool              *ProcessingPool
+	inflight          singleflight.Group
+	watermarks        *actor.WatermarkCache
+	fonts             *actor.FontCache
+	fontDir           string
+	fontStoragePrefix string
 }
 
 // NewImageUsecase creates a new ImageUsecase.
@@ -39,35 +69,61 @@ func NewImageUsecaseWithConfig(ctx context.Context) (*ImageUsecase, error) {
 		return nil, err
 	}
 	return &ImageUsecase{
-		cloudstorage: cloudstorage,
+		cloudstorage:      cloudstorage,
+		pool:              newProcessingPool(),
+		watermarks:        newWatermarkCache(),
+		fonts:             newFontCache(),
+		fontDir:           os.Getenv("FONT_DIR"),
+		fontStoragePrefix: os.Getenv("FONT_STORAGE_PREFIX"),
 	}, nil
 }
 
 func (iu *ImageUsecase) GetImage(ctx context.Context, imageoption actor.ImageOperatorOption, storageKeyValue string) (string, []byte, error) {
+	contenttype, imagebyte, _, err := iu.GetImageWithTrimBox(ctx, imageoption, storageKeyValue)
+	return contenttype, imagebyte, err
+}
+
+// GetImageWithTrimBox gets image with the box of source kept by trim option.
+// Concurrent requests of the same image and option share one computation.
+func (iu *ImageUsecase) GetImageWithTrimBox(ctx context.Context, imageoption actor.ImageOperatorOption, storageKeyValue string) (string, []byte, image.Rectangle, error) {
+	key := fmt.Sprintf("image:%s:%+v", storageKeyValue, imageoption)
+	result, err := coalesce(ctx, &iu.inflight, key, func(ctx context.Context) (imageResult, error) {
+		contenttype, imagebyte, trimbox, err := iu.getImage(ctx, imageoption, storageKeyValue)
+		return imageResult{contenttype: contenttype, content: imagebyte, trimbox: trimbox}, err
+	})
+	return result.contenttype, result.content, result.trimbox, err
+}
+
+func (iu *ImageUsecase) getImage(ctx context.Context, imageoption actor.ImageOperatorOption, storageKeyValue string) (string, []byte, image.Rectangle, error) {
 	// get from storage
 	contenttype, imagebyte, err := iu.cloudstorage.Get(ctx, storageKeyValue)
 	if err != nil {
-		return contenttype, imagebyte, err
+		return contenttype, imagebyte, image.Rectangle{}, err
 	}
 	// resizing image
-	if reflect.DeepEqual(imageoption, actor.ImageOperatorOption{}) {
-		return contenttype, imagebyte, nil
+	if actor.IsPassthroughOption(contenttype, imageoption) {
+		return contenttype, imagebyte, image.Rectangle{}, nil
 	}
-	imageOperator := actor.NewImageOperator(contenttype, imageoption)
-	if err := imageOperator.Decode(ctx, bytes.NewReader(imagebyte)); err != nil {
-		return contenttype, nil, err
+	imageOperator, prepare, err := iu.newImageOperator(ctx, contenttype, imageoption)
+	outputtype := actor.OutputContentType(contenttype, imageoption)
+	if err != nil {
+		return outputtype, nil, image.Rectangle{}, err
 	}
-	if err := imageOperator.Process(ctx); err != nil {
-		return contenttype, nil, err
+	imagebyte, err = iu.processImage(ctx, imageOperator, prepare, bytes.NewReader(imagebyte))
+	if err != nil {
+		return outputtype, nil, image.Rectangle{}, err
 	}
-	imagebyte, err = imageOperator.ImageByte(ctx)
-	return contenttype, imagebyte, err
+	return imageOperator.OutputContentType(), imagebyte, imageOperator.TrimBox(), nil
 }
 
+// GetFile gets file from storage. Concurrent requests of the same file share one download.
 func (iu *ImageUsecase) GetFile(ctx context.Context, storageKeyValue string) (string, []byte, error) {
-	// get from storage
-	contenttype, filebyte, err := iu.cloudstorage.Get(ctx, storageKeyValue)
-	return contenttype, filebyte, err
+	result, err := coalesce(ctx, &iu.inflight, "file:"+storageKeyValue, func(ctx context.Context) (imageResult, error) {
+		// get from storage
+		contenttype, filebyte, err := iu.cloudstorage.Get(ctx, storageKeyValue)
+		return imageResult{contenttype: contenttype, content: filebyte}, err
+	})
+	return result.contenttype, result.content, err
 }
 
 func (iu *ImageUsecase) GetFileStream(ctx context.Context, storageKeyValue string) (string, int, io.ReadCloser, error) {
@@ -91,17 +147,19 @@ func (iu *ImageUsecase) ConvertImage(ctx context.Context, imageoption actor.Imag
 		return nil, ErrReaderNotReadSeeker
 	}
 	contenttype, _ := utils.GetContentTypeByReadSeeker(re)
-	imageOperator := actor.NewImageOperator(contenttype, imageoption)
-	if _, err := reader.Seek(0, io.SeekStart); err != nil {
-		return nil, err
-	}
-	if err := imageOperator.Decode(ctx, reader); err != nil {
+	imageOperator, prepare, err := iu.newImageOperator(ctx, contenttype, imageoption)
+	if err != nil {
 		return nil, err
 	}
-	if err := imageOperator.Process(ctx); err != nil {
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
-	return imageOperator.ImageByte(ctx)
+	return iu.processImage(ctx, imageOperator, prepare, reader)
+}
+
+// ProcessingStats returns running and waiting count of image processing.
+func (iu *ImageUsecase) ProcessingStats() entity.ProcessingStats {
+	return iu.pool.Stats()
 }
 
 func (iu *ImageUsecase) UploadToStorage(ctx context.Context, formKeyPath string, reader multipart.File, imagebyte []byte) error {
@@ -117,3 +175,150 @@ func (iu *ImageUsecase) UploadToStorage(ctx context.Context, formKeyPath string,
 	}
 	return iu.cloudstorage.Put(ctx, formKeyPath, rs)
 }
+
+// processImage prepares, decodes, processes and encodes image holding a slot of processing pool.
+func (iu *ImageUsecase) processImage(ctx context.Context, imageOperator *actor.ImageOperator, prepare func() error, reader io.ReadSeeker) ([]byte, error) {
+	var imagebyte []byte
+	err := iu.pool.Do(ctx, func() error {
+		if err := prepare(); err != nil {
+			return err
+		}
+		if err := imageOperator.Decode(ctx, reader); err != nil {
+			return err
+		}
+		if err := imageOperator.Process(ctx); err != nil {
+			return err
+		}
+		var err error
+		imagebyte, err = imageOperator.ImageByte(ctx)
+		return err
+	})
+	return imagebyte, err
+}
+
+// newImageOperator creates ImageOperator with watermark and font of option.
+// Watermark not in memory cache is fetched here, and decoded by returned prepare in processing pool.
+func (iu *ImageUsecase) newImageOperator(ctx context.Context, contenttype string, imageoption actor.ImageOperatorOption) (*actor.ImageOperator, func() error, error) {
+	imageOperator := actor.NewImageOperator(contenttype, imageoption)
+	prepare := func() error { return nil }
+	if imageoption.Watermark != "" {
+		watermark, watermarkbyte, err := iu.getWatermark(ctx, imageoption.Watermark)
+		if err != nil {
+			return nil, nil, err
+		}
+		if watermark != nil {
+			imageOperator.SetWatermark(watermark)
+		} else {
+			prepare = func() error {
+				return iu.decodeWatermark(imageOperator, imageoption.Watermark, watermarkbyte)
+			}
+		}
+	}
+	if imageoption.Text != "" && imageoption.TextFont != "" {
+		textfont, err := iu.getFont(ctx, imageoption.TextFont)
+		if err != nil {
+			return nil, nil, err
+		}
+		imageOperator.SetFont(textfont)
+	}
+	return imageOperator, prepare, nil
+}
+
+// getWatermark gets decoded watermark from memory cache, or its bytes from storage when not cached.
+//
+//nolint:ireturn
+func (iu *ImageUsecase) getWatermark(ctx context.Context, storageKeyValue string) (image.Image, []byte, error) {
+	if watermark, ok := iu.watermarks.Get(storageKeyValue); ok {
+		return watermark, nil, nil
+	}
+	_, watermarkbyte, err := iu.cloudstorage.Get(ctx, storageKeyValue)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, watermarkbyte, nil
+}
+
+// decodeWatermark decodes watermark bytes, keeps it in memory cache and sets it to ImageOperator.
+func (iu *ImageUsecase) decodeWatermark(imageOperator *actor.ImageOperator, storageKeyValue string, watermarkbyte []byte) error {
+	watermark, err := actor.DecodeWatermark(bytes.NewReader(watermarkbyte))
+	if err != nil {
+		return err
+	}
+	iu.watermarks.Set(storageKeyValue, watermark)
+	imageOperator.SetWatermark(watermark)
+	return nil
+}
+
+func newWatermarkCache() *actor.WatermarkCache {
+	//nolint:mnd
+	return actor.NewWatermarkCache(time.Duration(utils.GetOsEnvInt("WATERMARK_CACHE_EXPIRED", 3600)) * time.Second)
+}
+
+// getFont gets parsed font from bundled fonts, memory cache, font directory or storage.
+func (iu *ImageUsecase) getFont(ctx context.Context, name string) (*opentype.Font, error) {
+	if textfont, ok := actor.BundledFont(name); ok {
+		return textfont, nil
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFontName, name)
+	}
+	if textfont, ok := iu.fonts.Get(name); ok {
+		return textfont, nil
+	}
+	fontbyte, err := iu.readFont(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	textfont, err := actor.ParseFont(fontbyte)
+	if err != nil {
+		return nil, err
+	}
+	iu.fonts.Set(name, textfont)
+	return textfont, nil
+}
+
+// readFont reads ttf or otf of name from font directory and then storage prefix.
+func (iu *ImageUsecase) readFont(ctx context.Context, name string) ([]byte, error) {
+	for _, ext := range []string{".ttf", ".otf"} {
+		if iu.fontDir != "" {
+			if fontbyte, err := os.ReadFile(filepath.Join(iu.fontDir, name+ext)); err == nil {
+				return fontbyte, nil
+			}
+		}
+		if iu.fontStoragePrefix != "" {
+			if _, fontbyte, err := iu.cloudstorage.Get(ctx, path.Join(iu.fontStoragePrefix, name+ext)); err == nil {
+				return fontbyte, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", actor.ErrFontNotFound, name)
+}
+
+func newFontCache() *actor.FontCache {
+	//nolint:mnd
+	return actor.NewFontCache(time.Duration(utils.GetOsEnvInt("FONT_CACHE_EXPIRED", 3600)) * time.Second)
+}
+
+// coalesce runs fn once for concurrent calls of the same key and shares its result with all of them.
+// fn runs without cancellation of the callers, so that a canceled caller does not abort the work for the others.
+// Panic of fn is returned as error, because singleflight re-panics it on a new goroutine that no middleware can recover.
+func coalesce[T any](ctx context.Context, group *singleflight.Group, key string, fn func(context.Context) (T, error)) (T, error) {
+	ch := group.DoChan(key, func() (val any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error(ctx, fmt.Sprintf("panic in shared work: %v\n%s", r, debug.Stack()))
+				var zero T
+				val, err = zero, fmt.Errorf("%w: %v", ErrProcessingPanic, r)
+			}
+		}()
+		return fn(context.WithoutCancel(ctx))
+	})
+	select {
+	case res := <-ch:
+		//nolint:forcetypeassert
+		return res.Val.(T), res.Err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"image/color"
 	"image/png"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -15,6 +17,10 @@ import (
 	"github.com/howood/imagereductor/application/actor/storageservice"
 	"github.com/howood/imagereductor/application/usecase"
 	"github.com/howood/imagereductor/infrastructure/client/cloudstorages"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/tiff"
 )
 
 func createTestPNG(t *testing.T) []byte {
@@ -226,6 +232,34 @@ func TestImageUsecase_GetImage_WithResize(t *testing.T) {
 	}
 }
 
+func TestImageUsecase_GetImage_WithFormat(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := setupImageUsecaseRaw(t)
+	ctx := t.Context()
+
+	pngData := createTestPNG(t)
+	if err := s.csa.Put(ctx, "img/format.png", bytes.NewReader(pngData)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	opt := actor.ImageOperatorOption{Format: actor.ImageFormatJpeg}
+	contenttype, data, err := s.uc.GetImage(ctx, opt, "img/format.png")
+	if err != nil {
+		t.Fatalf("GetImage: %v", err)
+	}
+	if contenttype != "image/jpeg" {
+		t.Fatalf("contenttype = %q, want image/jpeg", contenttype)
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || format != "jpeg" {
+		t.Fatalf("expected jpeg output, got %q (%v)", format, err)
+	}
+}
+
 func TestImageUsecase_ConvertImage(t *testing.T) {
 	t.Parallel()
 
@@ -249,6 +283,40 @@ func TestImageUsecase_ConvertImage(t *testing.T) {
 	}
 }
 
+func TestImageUsecase_ConvertImage_BMPAndTIFF(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := setupImageUsecaseRaw(t)
+	ctx := t.Context()
+
+	src, _, err := image.Decode(bytes.NewReader(createTestPNG(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for format, encode := range map[string]func(io.Writer, image.Image) error{
+		"bmp":  bmp.Encode,
+		"tiff": func(w io.Writer, m image.Image) error { return tiff.Encode(w, m, nil) },
+	} {
+		var buf bytes.Buffer
+		if err := encode(&buf, src); err != nil {
+			t.Fatalf("encode %s: %v", format, err)
+		}
+		opt := actor.ImageOperatorOption{Width: 30}
+		result, err := s.uc.ConvertImage(ctx, opt, newFakeMultipartFile(bytes.NewReader(buf.Bytes())))
+		if err != nil {
+			t.Fatalf("ConvertImage %s: %v", format, err)
+		}
+		cfg, got, err := image.DecodeConfig(bytes.NewReader(result))
+		if err != nil || got != format || cfg.Width != 30 {
+			t.Fatalf("expected 30px wide %s, got %d %q (%v)", format, cfg.Width, got, err)
+		}
+	}
+}
+
 func TestImageUsecase_UploadToStorage_WithReader(t *testing.T) {
 	t.Parallel()
 
@@ -463,3 +531,107 @@ func TestImageUsecase_UploadToStorage_SeekError(t *testing.T) {
 		t.Fatal("expected seek error, got nil")
 	}
 }
+
+func TestImageUsecase_GetImage_WithWatermark(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := setupImageUsecaseRaw(t)
+	ctx := t.Context()
+
+	if err := s.csa.Put(ctx, "img/base.png", bytes.NewReader(createTestPNG(t))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	logo := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	for y := range 10 {
+		for x := range 10 {
+			logo.Set(x, y, color.NRGBA{R: 0, G: 0, B: 255, A: 255})
+		}
+	}
+	var logoBuf bytes.Buffer
+	if err := png.Encode(&logoBuf, logo); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.csa.Put(ctx, "img/logo.png", bytes.NewReader(logoBuf.Bytes())); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	opt := actor.ImageOperatorOption{Width: 50, Watermark: "img/logo.png"}
+	for i := range 2 {
+		_, data, err := s.uc.GetImage(ctx, opt, "img/base.png")
+		if err != nil {
+			t.Fatalf("GetImage: %v", err)
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, _, b, _ := img.At(45, 45).RGBA(); r>>8 != 0 || b>>8 != 255 {
+			t.Fatalf("watermark pixel = %v", img.At(45, 45))
+		}
+		if i > 0 {
+			continue
+		}
+		// decoded watermark is kept in memory after the first request
+		if err := s.csa.Delete(ctx, "img/logo.png"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+}
+
+func TestImageUsecase_GetImage_WatermarkNotFound(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	s := setupImageUsecaseRaw(t)
+	ctx := t.Context()
+
+	if err := s.csa.Put(ctx, "img/base.png", bytes.NewReader(createTestPNG(t))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	opt := actor.ImageOperatorOption{Width: 50, Watermark: "img/missing.png"}
+	if _, _, err := s.uc.GetImage(ctx, opt, "img/base.png"); err == nil {
+		t.Fatal("expected error for missing watermark")
+	}
+}
+
+func TestImageUsecase_GetImage_WithTextFont(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	base := setupImageUsecaseRaw(t)
+	ctx := t.Context()
+	fontDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(fontDir, "local.ttf"), goregular.TTF, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.csa.Put(ctx, "fonts/remote.ttf", bytes.NewReader(gobold.TTF)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := base.csa.Put(ctx, "img/base.png", bytes.NewReader(createTestPNG(t))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	uc := usecase.NewImageUsecaseWithFontsForTest(base.csa, fontDir, "fonts")
+
+	for _, name := range []string{"", "gomono", "local", "remote"} {
+		opt := actor.ImageOperatorOption{Text: "SOLD", TextFont: name, TextColor: color.NRGBA{A: 255}}
+		if _, _, err := uc.GetImage(ctx, opt, "img/base.png"); err != nil {
+			t.Fatalf("GetImage font %q: %v", name, err)
+		}
+	}
+	if _, _, err := uc.GetImage(ctx, actor.ImageOperatorOption{Text: "SOLD", TextFont: "missing"}, "img/base.png"); !errors.Is(err, actor.ErrFontNotFound) {
+		t.Fatalf("expected ErrFontNotFound, got %v", err)
+	}
+	if _, _, err := uc.GetImage(ctx, actor.ImageOperatorOption{Text: "SOLD", TextFont: "../local"}, "img/base.png"); !errors.Is(err, usecase.ErrInvalidFontName) {
+		t.Fatalf("expected ErrInvalidFontName, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/howood/imagereductor/application/actor"
+	"golang.org/x/sync/singleflight"
+)
+
+func Test_coalesce_SharesResult(t *testing.T) {
+	t.Parallel()
+
+	var group singleflight.Group
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(context.Context) (string, error) {
+		calls.Add(1)
+		close(started)
+		<-release
+		return "resized", nil
+	}
+
+	const waiters = 5
+	results := make([]string, waiters)
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		results[0], _ = coalesce(t.Context(), &group, "key", fn)
+	})
+	<-started
+	var entered sync.WaitGroup
+	for i := 1; i < waiters; i++ {
+		entered.Add(1)
+		wg.Go(func() {
+			entered.Done()
+			results[i], _ = coalesce(t.Context(), &group, "key", fn)
+		})
+	}
+	entered.Wait()
+	// let the waiters join the in-flight call before it finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("calls = %d, want 1", got)
+	}
+	for i, got := range results {
+		if got != "resized" {
+			t.Fatalf("results[%d] = %q, want resized", i, got)
+		}
+	}
+}
+
+func Test_coalesce_CallerCancel(t *testing.T) {
+	t.Parallel()
+
+	var group singleflight.Group
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var workErr error
+	fn := func(ctx context.Context) (string, error) {
+		close(started)
+		<-release
+		workErr = ctx.Err()
+		return "resized", nil
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	canceled := make(chan error)
+	go func() {
+		_, err := coalesce(ctx, &group, "key", fn)
+		canceled <- err
+	}()
+	<-started
+	other := make(chan string)
+	go func() {
+		result, _ := coalesce(t.Context(), &group, "key", fn)
+		other <- result
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled for canceled caller, got %v", err)
+	}
+	close(release)
+	if got := <-other; got != "resized" {
+		t.Fatalf("other caller got %q, want resized", got)
+	}
+	if workErr != nil {
+		t.Fatalf("shared work was canceled: %v", workErr)
+	}
+}
+
+func Test_coalesce_Panic(t *testing.T) {
+	t.Parallel()
+
+	var group singleflight.Group
+	result, err := coalesce(t.Context(), &group, "key", func(context.Context) (imageResult, error) {
+		panic("huge or negative dimensions")
+	})
+	if !errors.Is(err, ErrProcessingPanic) {
+		t.Fatalf("expected ErrProcessingPanic, got %v", err)
+	}
+	if result.content != nil {
+		t.Fatalf("expected zero result, got %+v", result)
+	}
+	// the key is released so that later calls run again
+	result, err = coalesce(t.Context(), &group, "key", func(context.Context) (imageResult, error) {
+		return imageResult{contenttype: "image/png"}, nil
+	})
+	if err != nil || result.contenttype != "image/png" {
+		t.Fatalf("coalesce after panic = %+v, %v", result, err)
+	}
+}
+
+func Test_processImage_DecodeWatermarkInPool(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatal(err)
+	}
+	iu := &ImageUsecase{pool: NewProcessingPool(1, 0, time.Second), watermarks: newWatermarkCache()}
+	imageOperator := actor.NewImageOperator("image/png", actor.ImageOperatorOption{Watermark: "img/logo.png"})
+	var running int
+	prepare := func() error {
+		running = iu.pool.Stats().Running
+		return iu.decodeWatermark(imageOperator, "img/logo.png", buf.Bytes())
+	}
+
+	// watermark is not decoded while the pool is busy
+	release := make(chan struct{})
+	held := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = iu.pool.Do(t.Context(), func() error {
+			close(held)
+			<-release
+			return nil
+		})
+	}()
+	<-held
+	if _, err := iu.processImage(t.Context(), imageOperator, prepare, bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrProcessingBusy) {
+		t.Fatalf("expected ErrProcessingBusy, got %v", err)
+	}
+	if _, ok := iu.watermarks.Get("img/logo.png"); ok {
+		t.Fatal("watermark should not be decoded out of the pool")
+	}
+	close(release)
+	<-done
+
+	if _, err := iu.processImage(t.Context(), imageOperator, prepare, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("processImage: %v", err)
+	}
+	if running != 1 {
+		t.Errorf("watermark should be decoded holding a slot, running = %d", running)
+	}
+	if _, ok := iu.watermarks.Get("img/logo.png"); !ok {
+		t.Error("decoded watermark should be cached")
+	}
+}
@@ -0,0 +1,83 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/howood/imagereductor/domain/entity"
+	"github.com/howood/imagereductor/library/utils"
+)
+
+// ErrProcessingBusy is returned when image processing can not start within the queue limit or wait timeout.
+var ErrProcessingBusy = errors.New("image processing is busy")
+
+// ProcessingPool bounds concurrent image processing with a waiting queue.
+type ProcessingPool struct {
+	slots      chan struct{}
+	waiting    atomic.Int64
+	queueLimit int64
+	timeout    time.Duration
+}
+
+// NewProcessingPool creates a new ProcessingPool.
+func NewProcessingPool(concurrency, queueLimit int, timeout time.Duration) *ProcessingPool {
+	return &ProcessingPool{
+		slots:      make(chan struct{}, max(concurrency, 1)),
+		queueLimit: int64(max(queueLimit, 0)),
+		timeout:    timeout,
+	}
+}
+
+// Do runs fn holding a slot of the pool. It waits for a slot while the queue has room until timeout.
+func (p *ProcessingPool) Do(ctx context.Context, fn func() error) error {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		if err := p.wait(ctx); err != nil {
+			return err
+		}
+	}
+	defer func() { <-p.slots }()
+	return fn()
+}
+
+func (p *ProcessingPool) wait(ctx context.Context) error {
+	if p.waiting.Add(1) > p.queueLimit {
+		p.waiting.Add(-1)
+		return fmt.Errorf("%w: queue limit %d exceeded", ErrProcessingBusy, p.queueLimit)
+	}
+	defer p.waiting.Add(-1)
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: waited %v", ErrProcessingBusy, p.timeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns running and waiting count of the pool.
+func (p *ProcessingPool) Stats() entity.ProcessingStats {
+	return entity.ProcessingStats{
+		Running:     len(p.slots),
+		Waiting:     int(p.waiting.Load()),
+		Concurrency: cap(p.slots),
+		QueueLimit:  int(p.queueLimit),
+	}
+}
+
+func newProcessingPool() *ProcessingPool {
+	//nolint:mnd
+	return NewProcessingPool(
+		utils.GetOsEnvInt("PROCESSING_CONCURRENCY", runtime.NumCPU()),
+		utils.GetOsEnvInt("PROCESSING_QUEUE_LIMIT", runtime.NumCPU()*4),
+		time.Duration(utils.GetOsEnvInt("PROCESSING_WAIT_TIMEOUT", 10))*time.Second,
+	)
+}
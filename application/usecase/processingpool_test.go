@@ -0,0 +1,106 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/howood/imagereductor/application/usecase"
+)
+
+// holdSlots fills running slots of pool until release is closed.
+func holdSlots(t *testing.T, pool *usecase.ProcessingPool, n int) chan struct{} {
+	t.Helper()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	for range n {
+		go func() {
+			_ = pool.Do(context.Background(), func() error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+		<-started
+	}
+	return release
+}
+
+func Test_ProcessingPool_Do(t *testing.T) {
+	t.Parallel()
+
+	pool := usecase.NewProcessingPool(2, 1, time.Second)
+	called := false
+	if err := pool.Do(t.Context(), func() error {
+		called = true
+		if got := pool.Stats().Running; got != 1 {
+			t.Errorf("Running = %d, want 1", got)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("fn was not called")
+	}
+	if got := pool.Stats(); got.Running != 0 || got.Concurrency != 2 || got.QueueLimit != 1 {
+		t.Fatalf("Stats = %+v", got)
+	}
+}
+
+func Test_ProcessingPool_WaitsForSlot(t *testing.T) {
+	t.Parallel()
+
+	pool := usecase.NewProcessingPool(1, 1, 5*time.Second)
+	release := holdSlots(t, pool, 1)
+	done := make(chan error)
+	go func() {
+		done <- pool.Do(context.Background(), func() error { return nil })
+	}()
+	for pool.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("expected waiting caller to run, got %v", err)
+	}
+}
+
+func Test_ProcessingPool_QueueLimit(t *testing.T) {
+	t.Parallel()
+
+	pool := usecase.NewProcessingPool(1, 0, time.Second)
+	release := holdSlots(t, pool, 1)
+	defer close(release)
+	if err := pool.Do(t.Context(), func() error { return nil }); !errors.Is(err, usecase.ErrProcessingBusy) {
+		t.Fatalf("expected ErrProcessingBusy, got %v", err)
+	}
+}
+
+func Test_ProcessingPool_WaitTimeout(t *testing.T) {
+	t.Parallel()
+
+	pool := usecase.NewProcessingPool(1, 1, 10*time.Millisecond)
+	release := holdSlots(t, pool, 1)
+	defer close(release)
+	if err := pool.Do(t.Context(), func() error { return nil }); !errors.Is(err, usecase.ErrProcessingBusy) {
+		t.Fatalf("expected ErrProcessingBusy, got %v", err)
+	}
+	if got := pool.Stats().Waiting; got != 0 {
+		t.Fatalf("Waiting = %d after timeout, want 0", got)
+	}
+}
+
+func Test_ProcessingPool_ContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	pool := usecase.NewProcessingPool(1, 1, time.Second)
+	release := holdSlots(t, pool, 1)
+	defer close(release)
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := pool.Do(ctx, func() error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -4,5 +4,13 @@ import "github.com/howood/imagereductor/application/actor/storageservice"
 
 // NewImageUsecaseForTest creates an ImageUsecase with the given CloudStorageAssessor for testing.
 func NewImageUsecaseForTest(csa *storageservice.CloudStorageAssessor) *ImageUsecase {
-	return &ImageUsecase{cloudstorage: csa}
+	return &ImageUsecase{cloudstorage: csa, pool: newProcessingPool(), watermarks: newWatermarkCache(), fonts: newFontCache()}
+}
+
+// NewImageUsecaseWithFontsForTest creates an ImageUsecase with font directory and font storage prefix for testing.
+func NewImageUsecaseWithFontsForTest(csa *storageservice.CloudStorageAssessor, fontDir, fontStoragePrefix string) *ImageUsecase {
+	uc := NewImageUsecaseForTest(csa)
+	uc.fontDir = fontDir
+	uc.fontStoragePrefix = fontStoragePrefix
+	return uc
 }
@@ -11,6 +11,9 @@ import (
 
 	log "github.com/howood/imagereductor/infrastructure/logger"
 	"github.com/howood/imagereductor/library/utils"
+	_ "golang.org/x/image/bmp"  // register bmp decoder
+	_ "golang.org/x/image/tiff" // register tiff decoder
+	_ "golang.org/x/image/webp" // register webp decoder
 )
 
 const (
@@ -24,6 +27,8 @@ const (
 	ImageTypeBmp = "bmp"
 	// ImageTypeTiff is type of TIFF.
 	ImageTypeTiff = "tiff"
+	// ImageTypeWebp is type of WebP.
+	ImageTypeWebp = "webp"
 )
 
 // Sentinel errors for image validation.
@@ -37,7 +42,7 @@ var (
 // imageTypeList is list of image types.
 //
 //nolint:gochecknoglobals
-var imageTypeList = []string{ImageTypeJpeg, ImageTypeGif, ImageTypePng, ImageTypeBmp, ImageTypeTiff}
+var imageTypeList = []string{ImageTypeJpeg, ImageTypeGif, ImageTypePng, ImageTypeBmp, ImageTypeTiff, ImageTypeWebp}
 
 // ImageValidator struct.
 type ImageValidator struct {
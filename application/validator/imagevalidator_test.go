@@ -10,6 +10,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/gen2brain/webp"
 	"github.com/howood/imagereductor/application/validator"
 )
 
@@ -128,3 +129,17 @@ func Test_ImageValidator_FiltersUnknownTypes(t *testing.T) {
 		t.Fatalf("expected valid image, got error: %v", err)
 	}
 }
+
+func Test_ImageValidator_Webp(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	buf := new(bytes.Buffer)
+	if err := webp.Encode(buf, img, webp.Options{Lossless: true}); err != nil {
+		t.Fatalf("webp.Encode: %v", err)
+	}
+	v := validator.NewImageValidator([]string{validator.ImageTypeWebp}, 100, 100, 0)
+	if err := v.Validate(t.Context(), bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("expected valid webp image, got error: %v", err)
+	}
+}
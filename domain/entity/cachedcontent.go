@@ -5,4 +5,5 @@ type CachedContent struct {
 	ContentType  string
 	LastModified string
 	Content      []byte
+	Headers      map[string]string
 }
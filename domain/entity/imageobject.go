@@ -1,15 +1,28 @@
 package entity
 
-import "image"
+import (
+	"image"
+	"image/gif"
+
+	"golang.org/x/image/font/opentype"
+)
 
 // ImageObject entity.
 type ImageObject struct {
-	Source      image.Image
-	Dst         image.Image
-	OriginX     int
-	OriginY     int
-	DstX        int
-	DstY        int
-	ImageName   string
-	ContentType string
+	Source       image.Image
+	Dst          image.Image
+	SourceFrames []image.Image
+	DstFrames    []image.Image
+	Animation    *gif.GIF
+	Watermark    image.Image
+	Font         *opentype.Font
+	OriginX      int
+	OriginY      int
+	TrimBox      image.Rectangle
+	BoxX         int
+	BoxY         int
+	DstX         int
+	DstY         int
+	ImageName    string
+	ContentType  string
 }
@@ -1,13 +1,51 @@
 package entity
 
+import "image/color"
+
 // ImageObjectOption entity.
 type ImageObjectOption struct {
-	Width      int
-	Height     int
-	Quality    int
-	Rotate     string
-	Crop       [4]int
-	Brightness int
-	Contrast   int
-	Gamma      float64
+	Width             int
+	Height            int
+	Dpr               float64
+	Enlarge           bool
+	Quality           int
+	Rotate            string
+	Flip              string
+	Radius            string
+	Trim              int
+	Crop              [4]int
+	Brightness        int
+	Contrast          int
+	Gamma             float64
+	Lossless          bool
+	Format            string
+	AutoFormat        bool
+	Fit               string
+	Background        color.NRGBA
+	Gravity           string
+	FocalPoint        [2]float64
+	Frame             int
+	Compression       string
+	Blur              float64
+	Sharpen           [3]float64
+	Grayscale         bool
+	Sepia             int
+	Saturation        int
+	HueRotate         int
+	Invert            bool
+	ColorMatrix       [20]float64
+	Watermark         string
+	WatermarkPosition string
+	WatermarkMargin   int
+	WatermarkOpacity  int
+	WatermarkScale    float64
+	Text              string
+	TextFont          string
+	TextSize          float64
+	TextColor         color.NRGBA
+	TextStroke        int
+	TextStrokeColor   color.NRGBA
+	TextPosition      string
+	TextMargin        int
+	TextBackground    color.NRGBA
 }
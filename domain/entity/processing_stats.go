@@ -0,0 +1,9 @@
+package entity
+
+// ProcessingStats entity.
+type ProcessingStats struct {
+	Running     int `json:"running"`
+	Waiting     int `json:"waiting"`
+	Concurrency int `json:"concurrency"`
+	QueueLimit  int `json:"queue_limit"`
+}
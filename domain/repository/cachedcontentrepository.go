@@ -6,6 +6,8 @@ type CachedContentRepository interface {
 	GetContentType() string
 	GetLastModified() string
 	GetContent() []byte
+	SetHeaders(headers map[string]string)
+	GetHeaders() map[string]string
 	GobEncode() ([]byte, error)
 	GobDecode(buf []byte) error
 }
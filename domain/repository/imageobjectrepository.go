@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"image"
 	"io"
+
+	"golang.org/x/image/font/opentype"
 )
 
 // ImageObjectRepository interface.
@@ -10,4 +13,8 @@ type ImageObjectRepository interface {
 	Decode(ctx context.Context, src io.ReadSeeker) error
 	Process(ctx context.Context) error
 	ImageByte(ctx context.Context) ([]byte, error)
+	OutputContentType() string
+	TrimBox() image.Rectangle
+	SetWatermark(watermark image.Image)
+	SetFont(textfont *opentype.Font)
 }
@@ -67,6 +67,7 @@ func main() {
 	e.POST("/files", imageReductorHandler.UploadFile, echojwt.WithConfig(jwtconfig))
 	e.GET("/streaming", imageReductorHandler.RequestStreaming)
 	e.GET("/info", imageReductorHandler.RequestInfo)
+	e.GET("/stats", handler.NewStatsHandler(baseHandler).Request, custommiddleware.IPRestriction())
 
 	if err := e.Start(":" + defaultPort); err != nil {
 		e.Logger.Error("failed to start server", "error", err)
@@ -0,0 +1,347 @@
+package caches
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/howood/imagereductor/domain/entity"
+	log "github.com/howood/imagereductor/infrastructure/logger"
+)
+
+const (
+	// diskCacheHeaderSize is bytes of expiration and key length header of cache file, followed by key and content.
+	diskCacheHeaderSize = 12
+	// diskCacheKeyLenOffset is offset of key length in header.
+	diskCacheKeyLenOffset = 8
+	// diskCacheTempPrefix is prefix of temporary file written before rename.
+	diskCacheTempPrefix = ".tmp-"
+	diskCacheDirPerm    = 0o750
+)
+
+// DiskCache struct stores cache in files sharded by key hash under directory, bounded by total bytes with LRU eviction.
+type DiskCache struct {
+	mu        sync.Mutex
+	dir       string
+	maxBytes  int64
+	entries   map[string]*list.Element
+	lru       *list.List
+	bytes     int64
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type diskCacheEntry struct {
+	name string
+	key  string
+	size int64
+}
+
+// NewDiskCache creates a new DiskCache in dir holding up to maxBytes in total.
+// Index of existing files is reloaded ordered by modified time so that entries survive restarts.
+// Key is kept in each file, so that DelBulk matches glob pattern of keys also after restart.
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, diskCacheDirPerm); err != nil {
+		return nil, err
+	}
+	dc := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	if err := dc.loadIndex(); err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+// Get gets from cache.
+func (dc *DiskCache) Get(ctx context.Context, key string) (any, bool, error) {
+	name := diskCacheName(key)
+	dc.mu.Lock()
+	if _, ok := dc.entries[name]; !ok {
+		dc.misses++
+		dc.mu.Unlock()
+		return nil, false, nil
+	}
+	dc.mu.Unlock()
+	data, err := os.ReadFile(dc.path(name))
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	// entry may be evicted or replaced while reading
+	element, ok := dc.entries[name]
+	if !ok {
+		dc.misses++
+		return nil, false, nil
+	}
+	content, valid := diskCacheContent(data)
+	if err != nil || !valid || dc.isExpired(data) {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// file is already gone
+			dc.forget(element)
+		case err != nil:
+			log.Warn(ctx, "Disk Cache Read Error", err)
+			dc.remove(element)
+		default:
+			dc.remove(element)
+		}
+		dc.misses++
+		return nil, false, nil
+	}
+	dc.lru.MoveToFront(element)
+	now := time.Now()
+	// keep recency on disk for LRU order after restart
+	if err := os.Chtimes(dc.path(name), now, now); err != nil {
+		log.Debug(ctx, err)
+	}
+	dc.hits++
+	return content, true, nil
+}
+
+// Set puts to cache by writing temporary file and renaming it.
+func (dc *DiskCache) Set(ctx context.Context, key string, value any, ttl time.Duration) error {
+	content, err := cacheValueBytes(value)
+	if err != nil {
+		return err
+	}
+	size := int64(diskCacheHeaderSize + len(key) + len(content))
+	name := diskCacheName(key)
+	if size > dc.maxBytes {
+		log.Debug(ctx, fmt.Sprintf("too large to cache: %d bytes", size))
+		return dc.Del(ctx, key)
+	}
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+	tmpname, err := dc.writeTemp(name, key, expiresAt, content)
+	if err != nil {
+		return err
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if element, ok := dc.entries[name]; ok {
+		// file is replaced by rename
+		dc.forget(element)
+	}
+	for dc.bytes+size > dc.maxBytes {
+		dc.remove(dc.lru.Back())
+		dc.evictions++
+	}
+	if err := os.Rename(tmpname, dc.path(name)); err != nil {
+		_ = os.Remove(tmpname)
+		return err
+	}
+	dc.entries[name] = dc.lru.PushFront(&diskCacheEntry{name: name, key: key, size: size})
+	dc.bytes += size
+	return nil
+}
+
+// Del deletes from cache.
+func (dc *DiskCache) Del(_ context.Context, key string) error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if element, ok := dc.entries[diskCacheName(key)]; ok {
+		dc.remove(element)
+	}
+	return nil
+}
+
+// DelBulk bulk deletes keys matching glob pattern from cache.
+func (dc *DiskCache) DelBulk(_ context.Context, key string) error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	for _, element := range dc.entries {
+		//nolint:forcetypeassert
+		if matchGlob(key, element.Value.(*diskCacheEntry).key) {
+			dc.remove(element)
+		}
+	}
+	return nil
+}
+
+// CloseConnect close connection.
+func (dc *DiskCache) CloseConnect() error {
+	return nil
+}
+
+// Stats returns hit, miss and eviction counters and usage of cache.
+func (dc *DiskCache) Stats() entity.CacheStats {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return entity.CacheStats{
+		Hits:      dc.hits,
+		Misses:    dc.misses,
+		Evictions: dc.evictions,
+		Entries:   len(dc.entries),
+		Bytes:     dc.bytes,
+	}
+}
+
+// writeTemp writes header, key and content to temporary file in the shard to be renamed atomically.
+func (dc *DiskCache) writeTemp(name, key string, expiresAt int64, content []byte) (string, error) {
+	shard := filepath.Dir(dc.path(name))
+	if err := os.MkdirAll(shard, diskCacheDirPerm); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(shard, diskCacheTempPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	data := make([]byte, diskCacheHeaderSize, diskCacheHeaderSize+len(key)+len(content))
+	binary.BigEndian.PutUint64(data, uint64(expiresAt))                        //nolint:gosec
+	binary.BigEndian.PutUint32(data[diskCacheKeyLenOffset:], uint32(len(key))) //nolint:gosec
+	data = append(append(data, key...), content...)
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// loadIndex rebuilds LRU index from files, removing temporary files left by interrupted writes
+// and files of which key can not be read.
+func (dc *DiskCache) loadIndex() error {
+	type cachedFile struct {
+		name    string
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var files []cachedFile
+	err := filepath.WalkDir(dc.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), diskCacheTempPrefix) {
+			return os.Remove(path)
+		}
+		if len(d.Name()) != sha256.Size*2 || path != dc.path(d.Name()) {
+			// not a cache file
+			return nil
+		}
+		key, ok := readDiskCacheKey(path)
+		if !ok || diskCacheName(key) != d.Name() {
+			return os.Remove(path)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, cachedFile{name: d.Name(), key: key, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, file := range files {
+		dc.entries[file.name] = dc.lru.PushFront(&diskCacheEntry{name: file.name, key: file.key, size: file.size})
+		dc.bytes += file.size
+	}
+	for dc.bytes > dc.maxBytes {
+		dc.remove(dc.lru.Back())
+		dc.evictions++
+	}
+	return nil
+}
+
+func (dc *DiskCache) isExpired(data []byte) bool {
+	expiresAt := int64(binary.BigEndian.Uint64(data[:diskCacheHeaderSize])) //nolint:gosec
+	return expiresAt != 0 && time.Now().UnixNano() > expiresAt
+}
+
+// remove removes entry from index and its file.
+func (dc *DiskCache) remove(element *list.Element) {
+	entry := dc.forget(element)
+	if err := os.Remove(dc.path(entry.name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warn(context.Background(), "Disk Cache Remove Error", err)
+	}
+}
+
+// forget removes entry from index keeping its file.
+func (dc *DiskCache) forget(element *list.Element) *diskCacheEntry {
+	//nolint:forcetypeassert
+	entry := dc.lru.Remove(element).(*diskCacheEntry)
+	delete(dc.entries, entry.name)
+	dc.bytes -= entry.size
+	return entry
+}
+
+// path returns file path of name sharded by the first bytes of hash.
+func (dc *DiskCache) path(name string) string {
+	return filepath.Join(dc.dir, name[0:2], name[2:4], name)
+}
+
+// readDiskCacheKey reads key from header of cache file.
+func readDiskCacheKey(path string) (string, bool) {
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+	header := make([]byte, diskCacheHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return "", false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return "", false
+	}
+	keyLen := int64(binary.BigEndian.Uint32(header[diskCacheKeyLenOffset:]))
+	if keyLen > info.Size()-diskCacheHeaderSize {
+		return "", false
+	}
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(file, key); err != nil {
+		return "", false
+	}
+	return string(key), true
+}
+
+// diskCacheContent returns content following header and key of cache file data.
+func diskCacheContent(data []byte) ([]byte, bool) {
+	if len(data) < diskCacheHeaderSize {
+		return nil, false
+	}
+	keyEnd := diskCacheHeaderSize + int(binary.BigEndian.Uint32(data[diskCacheKeyLenOffset:]))
+	if len(data) < keyEnd {
+		return nil, false
+	}
+	return data[keyEnd:], true
+}
+
+func diskCacheName(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func cacheValueBytes(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedCacheValue, value)
+	}
+}
@@ -0,0 +1,239 @@
+package caches_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/howood/imagereductor/infrastructure/client/caches"
+)
+
+func cacheFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func Test_DiskCache_SetGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	dir := t.TempDir()
+	client, err := caches.NewDiskCache(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set(ctx, "/?key=a.jpg&w=100", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	val, ok, err := client.Get(ctx, "/?key=a.jpg&w=100")
+	if err != nil || !ok || string(val.([]byte)) != "value" { //nolint:forcetypeassert
+		t.Fatalf("Get = %v, %v, %v", val, ok, err)
+	}
+	files := cacheFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("files = %v", files)
+	}
+	// sharded by hash as dir/xx/yy/xxyy...
+	rel, _ := filepath.Rel(dir, files[0])
+	parts := strings.Split(rel, string(filepath.Separator))
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], parts[0]+parts[1]) {
+		t.Fatalf("unexpected cache file path %q", rel)
+	}
+	if stats := client.Stats(); stats.Hits != 1 || stats.Entries != 1 || stats.Bytes != 34 {
+		t.Fatalf("Stats = %+v", stats)
+	}
+}
+
+func Test_DiskCache_LRUEviction(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	// each entry is 12 bytes header, 1 byte key and 10 bytes content
+	client, err := caches.NewDiskCache(t.TempDir(), 69)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := client.Set(ctx, key, "0123456789", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, _ := client.Get(ctx, "a"); !ok {
+		t.Fatal("expected hit of a")
+	}
+	if err := client.Set(ctx, "d", "0123456789", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := client.Get(ctx, "b"); ok {
+		t.Fatal("least recently used b should be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok, _ := client.Get(ctx, key); !ok {
+			t.Fatalf("%s should be kept", key)
+		}
+	}
+	if stats := client.Stats(); stats.Evictions != 1 || stats.Bytes != 69 {
+		t.Fatalf("Stats = %+v", stats)
+	}
+}
+
+func Test_DiskCache_ReloadIndex(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	dir := t.TempDir()
+	client, err := caches.NewDiskCache(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set(ctx, "key", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// leftover of interrupted write and unrelated file
+	if err := os.WriteFile(filepath.Join(dir, ".tmp-123"), []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := caches.NewDiskCache(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, ok, err := reloaded.Get(ctx, "key")
+	if err != nil || !ok || string(val.([]byte)) != "value" { //nolint:forcetypeassert
+		t.Fatalf("Get after reload = %v, %v, %v", val, ok, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".tmp-123")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("temporary file should be removed at reload")
+	}
+	if stats := reloaded.Stats(); stats.Entries != 1 {
+		t.Fatalf("Stats = %+v", stats)
+	}
+}
+
+func Test_DiskCache_ReloadOverQuota(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	dir := t.TempDir()
+	client, err := caches.NewDiskCache(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{"old", "new"} {
+		if err := client.Set(ctx, key, "0123456789", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			past := time.Now().Add(-time.Hour)
+			for _, file := range cacheFiles(t, dir) {
+				if err := os.Chtimes(file, past, past); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	reloaded, err := caches.NewDiskCache(dir, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := reloaded.Get(ctx, "old"); ok {
+		t.Fatal("least recently used entry should be evicted over quota at reload")
+	}
+	if _, ok, _ := reloaded.Get(ctx, "new"); !ok {
+		t.Fatal("recent entry should be kept at reload")
+	}
+	if files := cacheFiles(t, dir); len(files) != 1 {
+		t.Fatalf("files = %v", files)
+	}
+}
+
+func Test_DiskCache_ExpiredAndDel(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	dir := t.TempDir()
+	client, err := caches.NewDiskCache(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set(ctx, "expired", "value", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set(ctx, "deleted", "value", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := client.Get(ctx, "expired"); ok {
+		t.Fatal("expected expired entry to miss")
+	}
+	if err := client.Del(ctx, "deleted"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := client.Get(ctx, "deleted"); ok {
+		t.Fatal("expected key to be deleted")
+	}
+	if files := cacheFiles(t, dir); len(files) != 0 {
+		t.Fatalf("files should be removed, got %v", files)
+	}
+	if err := client.Set(ctx, "key", 123, time.Minute); !errors.Is(err, caches.ErrUnsupportedCacheValue) {
+		t.Fatalf("expected ErrUnsupportedCacheValue, got %v", err)
+	}
+}
+
+func Test_DiskCache_DelBulkPattern(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	dir := t.TempDir()
+	client, err := caches.NewDiskCache(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"img/a.png", "img/b.png", "img/c.jpg", "other"} {
+		if err := client.Set(ctx, key, "v", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.DelBulk(ctx, "img/?.png"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"img/a.png", "img/b.png"} {
+		if _, ok, _ := client.Get(ctx, key); ok {
+			t.Errorf("%s should be deleted", key)
+		}
+	}
+	// keys are read from files after restart
+	reloaded, err := caches.NewDiskCache(dir, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.DelBulk(ctx, "img/*"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := reloaded.Get(ctx, "img/c.jpg"); ok {
+		t.Error("img/c.jpg should be deleted after reload")
+	}
+	if _, ok, _ := reloaded.Get(ctx, "other"); !ok {
+		t.Error("other should be kept")
+	}
+	if files := cacheFiles(t, dir); len(files) != 1 {
+		t.Fatalf("files = %v", files)
+	}
+}
@@ -0,0 +1,74 @@
+package caches
+
+import "strings"
+
+// matchGlob reports whether key matches glob pattern of redis KEYS command.
+// * and ? match any characters including /, [...] matches a class of characters and \ escapes the next character.
+//
+//nolint:cyclop
+func matchGlob(pattern, key string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			rest := strings.TrimLeft(pattern, "*")
+			if rest == "" {
+				return true
+			}
+			for i := range len(key) + 1 {
+				if matchGlob(rest, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if key == "" {
+				return false
+			}
+			pattern, key = pattern[1:], key[1:]
+			continue
+		case '[':
+			if key == "" {
+				return false
+			}
+			matched, rest := matchGlobClass(pattern[1:], key[0])
+			if !matched {
+				return false
+			}
+			pattern, key = rest, key[1:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+		}
+		if key == "" || pattern[0] != key[0] {
+			return false
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return key == ""
+}
+
+// matchGlobClass matches c with class of characters until ] and returns the rest of pattern.
+func matchGlobClass(pattern string, c byte) (bool, string) {
+	negate := strings.HasPrefix(pattern, "^")
+	if negate {
+		pattern = pattern[1:]
+	}
+	matched := false
+	for pattern != "" && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			matched = matched || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := min(pattern[0], pattern[2]), max(pattern[0], pattern[2])
+			matched = matched || (lo <= c && c <= hi)
+			pattern = pattern[3:]
+		default:
+			matched = matched || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+	return matched != negate, strings.TrimPrefix(pattern, "]")
+}
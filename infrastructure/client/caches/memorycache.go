@@ -0,0 +1,154 @@
+package caches
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/howood/imagereductor/domain/entity"
+	log "github.com/howood/imagereductor/infrastructure/logger"
+)
+
+// ErrUnsupportedCacheValue is returned when size of cache value can not be measured.
+var ErrUnsupportedCacheValue = errors.New("unsupported cache value")
+
+// MemoryCache struct is in-process cache bounded by total bytes with LRU eviction.
+type MemoryCache struct {
+	mu            sync.Mutex
+	entries       map[string]*list.Element
+	lru           *list.List
+	maxBytes      int64
+	maxEntryBytes int64
+	bytes         int64
+	hits          uint64
+	misses        uint64
+	evictions     uint64
+}
+
+type memoryCacheEntry struct {
+	key       string
+	value     any
+	size      int64
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates a new MemoryCache holding up to maxBytes in total.
+// Values larger than maxEntryBytes are never cached.
+func NewMemoryCache(maxBytes, maxEntryBytes int64) *MemoryCache {
+	return &MemoryCache{
+		entries:       make(map[string]*list.Element),
+		lru:           list.New(),
+		maxBytes:      maxBytes,
+		maxEntryBytes: maxEntryBytes,
+	}
+}
+
+// Get gets from cache.
+func (mc *MemoryCache) Get(_ context.Context, key string) (any, bool, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	element, ok := mc.entries[key]
+	if !ok {
+		mc.misses++
+		return nil, false, nil
+	}
+	//nolint:forcetypeassert
+	entry := element.Value.(*memoryCacheEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		mc.remove(element)
+		mc.misses++
+		return nil, false, nil
+	}
+	mc.lru.MoveToFront(element)
+	mc.hits++
+	return entry.value, true, nil
+}
+
+// Set puts to cache evicting least recently used entries over the budget.
+func (mc *MemoryCache) Set(ctx context.Context, key string, value any, ttl time.Duration) error {
+	size, err := cacheValueSize(value)
+	if err != nil {
+		return err
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if element, ok := mc.entries[key]; ok {
+		mc.remove(element)
+	}
+	if size > mc.maxEntryBytes || size > mc.maxBytes {
+		log.Debug(ctx, fmt.Sprintf("too large to cache: %d bytes", size))
+		return nil
+	}
+	for mc.bytes+size > mc.maxBytes {
+		mc.remove(mc.lru.Back())
+		mc.evictions++
+	}
+	entry := &memoryCacheEntry{key: key, value: value, size: size}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	mc.entries[key] = mc.lru.PushFront(entry)
+	mc.bytes += size
+	return nil
+}
+
+// Del deletes from cache.
+func (mc *MemoryCache) Del(_ context.Context, key string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if element, ok := mc.entries[key]; ok {
+		mc.remove(element)
+	}
+	return nil
+}
+
+// DelBulk bulk deletes keys matching glob pattern as well as redis.
+func (mc *MemoryCache) DelBulk(_ context.Context, key string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for name, element := range mc.entries {
+		if matchGlob(key, name) {
+			mc.remove(element)
+		}
+	}
+	return nil
+}
+
+// CloseConnect close connection.
+func (mc *MemoryCache) CloseConnect() error {
+	return nil
+}
+
+// Stats returns hit, miss and eviction counters and usage of cache.
+func (mc *MemoryCache) Stats() entity.CacheStats {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return entity.CacheStats{
+		Hits:      mc.hits,
+		Misses:    mc.misses,
+		Evictions: mc.evictions,
+		Entries:   len(mc.entries),
+		Bytes:     mc.bytes,
+	}
+}
+
+func (mc *MemoryCache) remove(element *list.Element) {
+	//nolint:forcetypeassert
+	entry := mc.lru.Remove(element).(*memoryCacheEntry)
+	delete(mc.entries, entry.key)
+	mc.bytes -= entry.size
+}
+
+func cacheValueSize(value any) (int64, error) {
+	switch v := value.(type) {
+	case []byte:
+		return int64(len(v)), nil
+	case string:
+		return int64(len(v)), nil
+	default:
+		return 0, fmt.Errorf("%w: %T", ErrUnsupportedCacheValue, value)
+	}
+}
@@ -0,0 +1,155 @@
+package caches_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/howood/imagereductor/infrastructure/client/caches"
+)
+
+func Test_MemoryCache_SetGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	client := caches.NewMemoryCache(100, 50)
+	if err := client.Set(ctx, "key", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	val, ok, err := client.Get(ctx, "key")
+	if err != nil || !ok || string(val.([]byte)) != "value" { //nolint:forcetypeassert
+		t.Fatalf("Get = %v, %v, %v", val, ok, err)
+	}
+	if _, ok, _ := client.Get(ctx, "missing"); ok {
+		t.Fatal("expected miss")
+	}
+	stats := client.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 || stats.Bytes != 5 {
+		t.Fatalf("Stats = %+v", stats)
+	}
+}
+
+func Test_MemoryCache_LRUEviction(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	client := caches.NewMemoryCache(30, 30)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := client.Set(ctx, key, "0123456789", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// touch a so that b is least recently used
+	if _, ok, _ := client.Get(ctx, "a"); !ok {
+		t.Fatal("expected hit of a")
+	}
+	if err := client.Set(ctx, "d", "0123456789", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := client.Get(ctx, "b"); ok {
+		t.Fatal("least recently used b should be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok, _ := client.Get(ctx, key); !ok {
+			t.Fatalf("%s should be kept", key)
+		}
+	}
+	if stats := client.Stats(); stats.Evictions != 1 || stats.Bytes != 30 {
+		t.Fatalf("Stats = %+v", stats)
+	}
+}
+
+func Test_MemoryCache_EntryTooLarge(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	client := caches.NewMemoryCache(100, 10)
+	if err := client.Set(ctx, "key", "small", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set(ctx, "key", "larger than entry cap", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := client.Get(ctx, "key"); ok {
+		t.Fatal("too large value should not be cached and replace old value")
+	}
+	if stats := client.Stats(); stats.Bytes != 0 || stats.Entries != 0 {
+		t.Fatalf("Stats = %+v", stats)
+	}
+}
+
+func Test_MemoryCache_Expired(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	client := caches.NewMemoryCache(100, 100)
+	if err := client.Set(ctx, "key", "value", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := client.Get(ctx, "key"); ok {
+		t.Fatal("expected expired entry to miss")
+	}
+	if stats := client.Stats(); stats.Bytes != 0 || stats.Misses != 1 {
+		t.Fatalf("Stats = %+v", stats)
+	}
+}
+
+func Test_MemoryCache_DelAndUnsupported(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	client := caches.NewMemoryCache(100, 100)
+	if err := client.Set(ctx, "key", "value", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Del(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := client.Get(ctx, "key"); ok {
+		t.Fatal("expected key to be deleted")
+	}
+	if err := client.Set(ctx, "key", 123, time.Minute); !errors.Is(err, caches.ErrUnsupportedCacheValue) {
+		t.Fatalf("expected ErrUnsupportedCacheValue, got %v", err)
+	}
+}
+
+func Test_MemoryCache_DelBulkPattern(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{"img/a.png", "img/b.png", "img/ab.png", "img/c.jpg", "*star", "other"}
+	tests := map[string]struct {
+		pattern string
+		deleted []string
+	}{
+		"all":       {"*", keys},
+		"prefix":    {"img/*", []string{"img/a.png", "img/b.png", "img/ab.png", "img/c.jpg"}},
+		"single":    {"img/?.png", []string{"img/a.png", "img/b.png"}},
+		"class":     {"img/[ab].png", []string{"img/a.png", "img/b.png"}},
+		"range":     {"img/[a-b]*", []string{"img/a.png", "img/b.png", "img/ab.png"}},
+		"negate":    {"img/[^a]*", []string{"img/b.png", "img/c.jpg"}},
+		"escape":    {"\\*star", []string{"*star"}},
+		"exact":     {"other", []string{"other"}},
+		"unmatched": {"img/*.gif", nil},
+	}
+	for name, tt := range tests {
+		ctx := t.Context()
+		client := caches.NewMemoryCache(1024, 1024)
+		for _, key := range keys {
+			if err := client.Set(ctx, key, "v", time.Minute); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := client.DelBulk(ctx, tt.pattern); err != nil {
+			t.Fatal(err)
+		}
+		if got := client.Stats().Entries; got != len(keys)-len(tt.deleted) {
+			t.Errorf("%s: entries = %d, want %d", name, got, len(keys)-len(tt.deleted))
+		}
+		for _, key := range tt.deleted {
+			if _, ok, _ := client.Get(ctx, key); ok {
+				t.Errorf("%s: %s should be deleted", name, key)
+			}
+		}
+	}
+}
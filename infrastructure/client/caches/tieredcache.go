@@ -0,0 +1,68 @@
+package caches
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/howood/imagereductor/infrastructure/logger"
+)
+
+// TieredCache struct layers in-process L1 cache in front of shared L2 cache.
+type TieredCache struct {
+	l1    CacheInstance
+	l2    CacheInstance
+	l1TTL time.Duration
+}
+
+// NewTieredCache creates a new TieredCache. Entries are kept in l1 for up to l1TTL.
+func NewTieredCache(l1, l2 CacheInstance, l1TTL time.Duration) *TieredCache {
+	return &TieredCache{
+		l1:    l1,
+		l2:    l2,
+		l1TTL: l1TTL,
+	}
+}
+
+// Get gets from L1 and then L2 cache. L2 hits populate L1.
+func (tc *TieredCache) Get(ctx context.Context, key string) (any, bool, error) {
+	if val, ok, err := tc.l1.Get(ctx, key); err == nil && ok {
+		log.Debug(ctx, "L1 cache hit")
+		return val, true, nil
+	}
+	val, ok, err := tc.l2.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if err := tc.l1.Set(ctx, key, val, tc.l1TTL); err != nil {
+		log.Warn(ctx, "L1 cache Set Error", err)
+	}
+	return val, true, nil
+}
+
+// Set puts to L2 and L1 cache.
+func (tc *TieredCache) Set(ctx context.Context, key string, value any, expired time.Duration) error {
+	if err := tc.l2.Set(ctx, key, value, expired); err != nil {
+		return err
+	}
+	l1TTL := tc.l1TTL
+	if expired > 0 {
+		l1TTL = min(expired, l1TTL)
+	}
+	return tc.l1.Set(ctx, key, value, l1TTL)
+}
+
+// Del deletes from L1 and L2 cache.
+func (tc *TieredCache) Del(ctx context.Context, key string) error {
+	return errors.Join(tc.l1.Del(ctx, key), tc.l2.Del(ctx, key))
+}
+
+// DelBulk bulk deletes from L1 and L2 cache.
+func (tc *TieredCache) DelBulk(ctx context.Context, key string) error {
+	return errors.Join(tc.l1.DelBulk(ctx, key), tc.l2.DelBulk(ctx, key))
+}
+
+// CloseConnect close connection.
+func (tc *TieredCache) CloseConnect() error {
+	return errors.Join(tc.l1.CloseConnect(), tc.l2.CloseConnect())
+}
@@ -0,0 +1,104 @@
+package caches_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/howood/imagereductor/infrastructure/client/caches"
+)
+
+func Test_TieredCache_L2HitPopulatesL1(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	l1 := caches.NewMemoryCache(1024, 1024)
+	l2 := caches.NewMemoryCache(1024, 1024)
+	tiered := caches.NewTieredCache(l1, l2, time.Minute)
+	if err := l2.Set(ctx, "key", "value", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := l1.Get(ctx, "key"); ok {
+		t.Fatal("L1 should be empty before Get")
+	}
+	val, ok, err := tiered.Get(ctx, "key")
+	if err != nil || !ok || val != "value" {
+		t.Fatalf("Get = %v, %v, %v", val, ok, err)
+	}
+	if val, ok, _ := l1.Get(ctx, "key"); !ok || val != "value" {
+		t.Fatalf("L2 hit should populate L1, got %v, %v", val, ok)
+	}
+}
+
+func Test_TieredCache_SetAndDel(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	l1 := caches.NewMemoryCache(1024, 1024)
+	l2 := caches.NewMemoryCache(1024, 1024)
+	tiered := caches.NewTieredCache(l1, l2, time.Minute)
+	if err := tiered.Set(ctx, "key", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]caches.CacheInstance{"L1": l1, "L2": l2} {
+		if _, ok, _ := c.Get(ctx, "key"); !ok {
+			t.Fatalf("Set should put to %s", name)
+		}
+	}
+	if err := tiered.Del(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]caches.CacheInstance{"L1": l1, "L2": l2} {
+		if _, ok, _ := c.Get(ctx, "key"); ok {
+			t.Fatalf("Del should delete from %s", name)
+		}
+	}
+	if _, ok, err := tiered.Get(ctx, "key"); ok || err != nil {
+		t.Fatalf("expected miss, got %v, %v", ok, err)
+	}
+}
+
+func Test_TieredCache_L1TTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	l1 := caches.NewMemoryCache(1024, 1024)
+	l2 := caches.NewMemoryCache(1024, 1024)
+	tiered := caches.NewTieredCache(l1, l2, 10*time.Millisecond)
+	if err := tiered.Set(ctx, "key", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := l1.Get(ctx, "key"); ok {
+		t.Fatal("L1 entry should expire by L1 TTL")
+	}
+	if _, ok, _ := tiered.Get(ctx, "key"); !ok {
+		t.Fatal("expected L2 hit after L1 expired")
+	}
+}
+
+func Test_TieredCache_DelBulk(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	l1 := caches.NewMemoryCache(1024, 1024)
+	l2 := caches.NewMemoryCache(1024, 1024)
+	tiered := caches.NewTieredCache(l1, l2, time.Minute)
+	for _, key := range []string{"bulk:img/a.png", "bulk:img/b.png", "other:img/a.png"} {
+		if err := tiered.Set(ctx, key, "value", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tiered.DelBulk(ctx, "bulk:*"); err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]caches.CacheInstance{"L1": l1, "L2": l2} {
+		for _, key := range []string{"bulk:img/a.png", "bulk:img/b.png"} {
+			if _, ok, _ := c.Get(ctx, key); ok {
+				t.Fatalf("DelBulk should delete %s from %s", key, name)
+			}
+		}
+		if _, ok, _ := c.Get(ctx, "other:img/a.png"); !ok {
+			t.Fatalf("DelBulk should keep unmatched key in %s", name)
+		}
+	}
+}
@@ -7,12 +7,22 @@ const (
 	FormKeyWidth = "w"
 	// FormKeyHeight is form key of height.
 	FormKeyHeight = "h"
+	// FormKeyDpr is form key of device pixel ratio.
+	FormKeyDpr = "dpr"
+	// FormKeyEnlarge is form key of enlarge.
+	FormKeyEnlarge = "enlarge"
 	// FormKeyQuality is form key of quality.
 	FormKeyQuality = "q"
 	// FormKeyNonUseCache is form key of nonusecache.
 	FormKeyNonUseCache = "nonusecache"
 	// FormKeyRotate is form key of round.
 	FormKeyRotate = "rotate"
+	// FormKeyFlip is form key of flip.
+	FormKeyFlip = "flip"
+	// FormKeyRadius is form key of corner radius.
+	FormKeyRadius = "radius"
+	// FormKeyTrim is form key of trim threshold.
+	FormKeyTrim = "trim"
 	// FormKeyCrop is form key of crop.
 	FormKeyCrop = "crop"
 	// FormKeyBrightness is form key of brightness.
@@ -21,6 +31,66 @@ const (
 	FormKeyContrast = "cont"
 	// FormKeyGamma is form key of gamma.
 	FormKeyGamma = "gam"
+	// FormKeyLossless is form key of lossless.
+	FormKeyLossless = "lossless"
+	// FormKeyFormat is form key of output format.
+	FormKeyFormat = "fmt"
+	// FormKeyFit is form key of fit.
+	FormKeyFit = "fit"
+	// FormKeyBackground is form key of background color.
+	FormKeyBackground = "bg"
+	// FormKeyGravity is form key of gravity.
+	FormKeyGravity = "gravity"
+	// FormKeyFocalPoint is form key of focal point.
+	FormKeyFocalPoint = "fp"
+	// FormKeyFrame is form key of frame.
+	FormKeyFrame = "frame"
+	// FormKeyCompression is form key of tiff compression.
+	FormKeyCompression = "compression"
+	// FormKeyBlur is form key of blur.
+	FormKeyBlur = "blur"
+	// FormKeySharpen is form key of sharpen.
+	FormKeySharpen = "sharpen"
+	// FormKeyGrayscale is form key of grayscale.
+	FormKeyGrayscale = "grayscale"
+	// FormKeySepia is form key of sepia.
+	FormKeySepia = "sepia"
+	// FormKeySaturation is form key of saturation.
+	FormKeySaturation = "sat"
+	// FormKeyHueRotate is form key of hue rotate.
+	FormKeyHueRotate = "hue"
+	// FormKeyInvert is form key of invert.
+	FormKeyInvert = "invert"
+	// FormKeyColorMatrix is form key of color matrix.
+	FormKeyColorMatrix = "matrix"
+	// FormKeyWatermark is form key of watermark storage key.
+	FormKeyWatermark = "wm"
+	// FormKeyWatermarkPosition is form key of watermark position.
+	FormKeyWatermarkPosition = "wmpos"
+	// FormKeyWatermarkMargin is form key of watermark margin.
+	FormKeyWatermarkMargin = "wmmargin"
+	// FormKeyWatermarkOpacity is form key of watermark opacity.
+	FormKeyWatermarkOpacity = "wmopacity"
+	// FormKeyWatermarkScale is form key of watermark scale.
+	FormKeyWatermarkScale = "wmscale"
+	// FormKeyText is form key of text overlay.
+	FormKeyText = "text"
+	// FormKeyTextFont is form key of text font.
+	FormKeyTextFont = "font"
+	// FormKeyTextSize is form key of text size.
+	FormKeyTextSize = "textsize"
+	// FormKeyTextColor is form key of text color.
+	FormKeyTextColor = "textcolor"
+	// FormKeyTextStroke is form key of text stroke width.
+	FormKeyTextStroke = "textstroke"
+	// FormKeyTextStrokeColor is form key of text stroke color.
+	FormKeyTextStrokeColor = "textstrokecolor"
+	// FormKeyTextPosition is form key of text position.
+	FormKeyTextPosition = "textpos"
+	// FormKeyTextMargin is form key of text margin.
+	FormKeyTextMargin = "textmargin"
+	// FormKeyTextBackground is form key of text background box color.
+	FormKeyTextBackground = "textbg"
 	// FormKeyUploadFile is form key of uploadfile.
 	FormKeyUploadFile = "uploadfile"
 	// FormKeyPath is form key of path.
@@ -28,4 +98,6 @@ const (
 
 	// FormValueTrue is form value of true.
 	FormValueTrue = "true"
+	// FormValueAuto is form value of auto.
+	FormValueAuto = "auto"
 )
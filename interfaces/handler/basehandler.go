@@ -63,6 +63,11 @@ func (bh BaseHandler) getHeaderExpires() int {
 	return utils.GetOsEnvInt("HEADEREXPIRED", 300)
 }
 
+//nolint:mnd
+func (bh BaseHandler) getRetryAfter() int {
+	return utils.GetOsEnvInt("PROCESSING_RETRY_AFTER", 1)
+}
+
 func (bh BaseHandler) jsonToByte(jsondata any) ([]byte, error) {
 	return json.MarshalIndent(jsondata, marshalPrefix, marshalIndent)
 }
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
 	"io"
+	"math"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -14,6 +17,7 @@ import (
 	"time"
 
 	"github.com/howood/imagereductor/application/actor"
+	"github.com/howood/imagereductor/application/usecase"
 	"github.com/howood/imagereductor/application/validator"
 	log "github.com/howood/imagereductor/infrastructure/logger"
 	"github.com/howood/imagereductor/infrastructure/requestid"
@@ -22,6 +26,9 @@ import (
 	"github.com/labstack/echo/v5"
 )
 
+// HeaderTrimBox is response header of the box of source kept by trim.
+const HeaderTrimBox = "X-Trim-Box"
+
 // ImageReductionHandler struct.
 type ImageReductionHandler struct {
 	BaseHandler
@@ -31,8 +38,30 @@ func NewImageReductionHandler(baseHandler BaseHandler) *ImageReductionHandler {
 	return &ImageReductionHandler{BaseHandler: baseHandler}
 }
 
+// negotiateImageFormat chooses output format from Accept header for fmt=auto.
+// Only explicitly listed media types are honored because old browsers send */*.
+func negotiateImageFormat(accept string) string {
+	for mediarange := range strings.SplitSeq(accept, ",") {
+		mediatype, params, _ := strings.Cut(mediarange, ";")
+		if strings.TrimSpace(mediatype) != "image/webp" {
+			continue
+		}
+		for param := range strings.SplitSeq(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				if q, err := strconv.ParseFloat(value, 64); err == nil && q <= 0 {
+					return ""
+				}
+			}
+		}
+		return actor.ImageFormatWebp
+	}
+	return ""
+}
+
 // normalizeCacheKey builds a deterministic cache key from form parameters
 // to prevent cache poisoning via arbitrary query parameter injection.
+// fmt=auto is expanded with the negotiated format so each variant is cached separately.
 func normalizeCacheKey(c *echo.Context) string {
 	params := c.Request().URL.Query()
 	keys := make([]string, 0, len(params))
@@ -50,6 +79,10 @@ func normalizeCacheKey(c *echo.Context) string {
 		sb.WriteString(k)
 		sb.WriteByte('=')
 		sb.WriteString(params.Get(k))
+		if k == config.FormKeyFormat && params.Get(k) == config.FormValueAuto {
+			sb.WriteByte(':')
+			sb.WriteString(negotiateImageFormat(c.Request().Header.Get(echo.HeaderAccept)))
+		}
 	}
 	return sb.String()
 }
@@ -69,6 +102,9 @@ func (irh *ImageReductionHandler) Request(c *echo.Context) error {
 	if err := validator.NewStorageKeyValidator().Validate(c.FormValue(config.FormKeyStorageKey)); err != nil {
 		return irh.errorResponse(ctx, c, http.StatusBadRequest, err)
 	}
+	if c.FormValue(config.FormKeyFormat) == config.FormValueAuto {
+		c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	}
 	if c.FormValue(config.FormKeyNonUseCache) != config.FormValueTrue && irh.getCache(ctx, c, cacheKey) {
 		log.Info(ctx, "cache hit!")
 		return nil
@@ -79,11 +115,15 @@ func (irh *ImageReductionHandler) Request(c *echo.Context) error {
 		log.Warn(ctx, err)
 		return irh.errorResponse(ctx, c, http.StatusBadRequest, err)
 	}
-	contenttype, imagebyte, err := irh.UcCluster.ImageUC.GetImage(ctx, imageoption, c.FormValue(config.FormKeyStorageKey))
+	contenttype, imagebyte, trimbox, err := irh.UcCluster.ImageUC.GetImageWithTrimBox(ctx, imageoption, c.FormValue(config.FormKeyStorageKey))
 	if err != nil {
-		return irh.errorResponse(ctx, c, http.StatusBadRequest, err)
+		return irh.processingErrorResponse(ctx, c, err)
+	}
+	headers := irh.imageHeaders(imageoption, trimbox)
+	irh.UcCluster.CacheUC.SetCacheWithHeaders(ctx, contenttype, imagebyte, headers, cacheKey, irh.setNewLatsModified())
+	for key, value := range headers {
+		c.Response().Header().Set(key, value)
 	}
-	irh.setCache(ctx, contenttype, imagebyte, cacheKey)
 	irh.setResponseHeader(
 		c,
 		irh.setNewLatsModified(),
@@ -117,7 +157,7 @@ func (irh *ImageReductionHandler) RequestFile(c *echo.Context) error {
 
 	contenttype, filebyte, err := irh.UcCluster.ImageUC.GetFile(ctx, c.FormValue(config.FormKeyStorageKey))
 	if err != nil {
-		return irh.errorResponse(ctx, c, http.StatusBadRequest, err)
+		return irh.processingErrorResponse(ctx, c, err)
 	}
 	irh.setCache(ctx, contenttype, filebyte, cacheKey)
 	irh.setResponseHeader(
@@ -234,7 +274,7 @@ func (irh *ImageReductionHandler) Upload(c *echo.Context) error {
 	// resizing image
 	convertedimagebyte, err := irh.UcCluster.ImageUC.ConvertImage(ctx, imageoption, reader)
 	if err != nil {
-		return irh.errorResponse(ctx, c, http.StatusBadRequest, err)
+		return irh.processingErrorResponse(ctx, c, err)
 	}
 	return irh.UcCluster.ImageUC.UploadToStorage(ctx, c.FormValue(config.FormKeyPath), reader, convertedimagebyte)
 }
@@ -289,6 +329,9 @@ func (irh *ImageReductionHandler) getCache(ctx context.Context, c *echo.Context,
 		irh.setExpires(lastmodified),
 		fmt.Sprintf("%v", ctx.Value(requestid.GetRequestIDKey())),
 	)
+	for key, value := range cachedcontent.GetHeaders() {
+		c.Response().Header().Set(key, value)
+	}
 	c.Response().Header().Set(echo.HeaderContentType, cachedcontent.GetContentType())
 	c.Response().WriteHeader(http.StatusOK)
 	if _, err = c.Response().Write(cachedcontent.GetContent()); err != nil {
@@ -298,6 +341,30 @@ func (irh *ImageReductionHandler) getCache(ctx context.Context, c *echo.Context,
 	return true
 }
 
+// processingErrorResponse responds 503 with Retry-After when image processing is busy,
+// 500 when it panicked, otherwise 400.
+func (irh *ImageReductionHandler) processingErrorResponse(ctx context.Context, c *echo.Context, err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrProcessingBusy):
+		c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(irh.getRetryAfter()))
+		return irh.errorResponse(ctx, c, http.StatusServiceUnavailable, err)
+	case errors.Is(err, usecase.ErrProcessingPanic):
+		return irh.errorResponse(ctx, c, http.StatusInternalServerError, err)
+	}
+	return irh.errorResponse(ctx, c, http.StatusBadRequest, err)
+}
+
+// imageHeaders returns response headers describing processed image.
+// X-Trim-Box is x,y,width,height of source kept by trim.
+func (irh *ImageReductionHandler) imageHeaders(imageoption actor.ImageOperatorOption, trimbox image.Rectangle) map[string]string {
+	if imageoption.Trim <= 0 {
+		return nil
+	}
+	return map[string]string{
+		HeaderTrimBox: fmt.Sprintf("%d,%d,%d,%d", trimbox.Min.X, trimbox.Min.Y, trimbox.Dx(), trimbox.Dy()),
+	}
+}
+
 func (irh *ImageReductionHandler) setCache(ctx context.Context, mimetype string, data []byte, requesturi string) {
 	irh.UcCluster.CacheUC.SetCache(ctx, mimetype, data, requesturi, irh.setNewLatsModified())
 }
@@ -306,16 +373,61 @@ func (irh *ImageReductionHandler) getImageOptionByFormValue(ctx context.Context,
 	var err error
 	option := actor.ImageOperatorOption{}
 	option.Rotate = c.FormValue(config.FormKeyRotate)
+	option.Flip = c.FormValue(config.FormKeyFlip)
+	option.Radius = c.FormValue(config.FormKeyRadius)
+	option.Trim, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyTrim), err)
+	option.Lossless = c.FormValue(config.FormKeyLossless) == config.FormValueTrue
+	option.Enlarge = c.FormValue(config.FormKeyEnlarge) == config.FormValueTrue
+	option.Fit = c.FormValue(config.FormKeyFit)
+	option.Gravity = c.FormValue(config.FormKeyGravity)
+	option.Compression = c.FormValue(config.FormKeyCompression)
+	option.Grayscale = c.FormValue(config.FormKeyGrayscale) == config.FormValueTrue
+	option.Invert = c.FormValue(config.FormKeyInvert) == config.FormValueTrue
 	option.Width, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyWidth), err)
 	option.Height, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyHeight), err)
+	option.Dpr, err = irh.setOptionValueFloat(ctx, c.FormValue(config.FormKeyDpr), err)
 	option.Quality, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyQuality), err)
 	option.Brightness, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyBrightness), err)
 	option.Contrast, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyContrast), err)
 	option.Gamma, err = irh.setOptionValueFloat(ctx, c.FormValue(config.FormKeyGamma), err)
+	option.Frame, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyFrame), err)
+	option.Blur, err = irh.setOptionValueFloat(ctx, c.FormValue(config.FormKeyBlur), err)
+	option.Sharpen, err = irh.getSharpenParam(ctx, c.FormValue(config.FormKeySharpen), err)
+	option.Sepia, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeySepia), err)
+	option.Saturation, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeySaturation), err)
+	option.HueRotate, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyHueRotate), err)
+	option.ColorMatrix, err = irh.getColorMatrixParam(ctx, c.FormValue(config.FormKeyColorMatrix), err)
 	option.Crop, err = irh.getCropParam(ctx, c.FormValue(config.FormKeyCrop), err)
+	option.Format, err = irh.getFormatParam(c.FormValue(config.FormKeyFormat), c.Request().Header.Get(echo.HeaderAccept), err)
+	option.AutoFormat = c.FormValue(config.FormKeyFormat) == config.FormValueAuto
+	option.Background, err = irh.getColorParam(ctx, c.FormValue(config.FormKeyBackground), err)
+	option.FocalPoint, err = irh.getFocalPointParam(ctx, c.FormValue(config.FormKeyFocalPoint), err)
+	if c.FormValue(config.FormKeyFocalPoint) != "" {
+		option.Gravity = actor.ImageGravityFocalPoint
+	}
+	err = irh.setOverlayOptionByFormValue(ctx, c, &option, err)
 	return option, err
 }
 
+// setOverlayOptionByFormValue sets watermark and text overlay options.
+func (irh *ImageReductionHandler) setOverlayOptionByFormValue(ctx context.Context, c *echo.Context, option *actor.ImageOperatorOption, err error) error {
+	option.WatermarkPosition = c.FormValue(config.FormKeyWatermarkPosition)
+	option.Text = c.FormValue(config.FormKeyText)
+	option.TextFont = c.FormValue(config.FormKeyTextFont)
+	option.TextPosition = c.FormValue(config.FormKeyTextPosition)
+	option.Watermark, err = irh.getWatermarkParam(c.FormValue(config.FormKeyWatermark), err)
+	option.WatermarkMargin, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyWatermarkMargin), err)
+	option.WatermarkOpacity, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyWatermarkOpacity), err)
+	option.WatermarkScale, err = irh.setOptionValueFloat(ctx, c.FormValue(config.FormKeyWatermarkScale), err)
+	option.TextSize, err = irh.setOptionValueFloat(ctx, c.FormValue(config.FormKeyTextSize), err)
+	option.TextStroke, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyTextStroke), err)
+	option.TextMargin, err = irh.setOptionValueInt(ctx, c.FormValue(config.FormKeyTextMargin), err)
+	option.TextColor, err = irh.getColorParam(ctx, c.FormValue(config.FormKeyTextColor), err)
+	option.TextStrokeColor, err = irh.getColorParam(ctx, c.FormValue(config.FormKeyTextStrokeColor), err)
+	option.TextBackground, err = irh.getColorParam(ctx, c.FormValue(config.FormKeyTextBackground), err)
+	return err
+}
+
 func (irh *ImageReductionHandler) setOptionValueInt(ctx context.Context, formvalue string, err error) (int, error) {
 	if err != nil {
 		return 0, err
@@ -339,7 +451,7 @@ func (irh *ImageReductionHandler) setOptionValueFloat(ctx context.Context, formv
 	if formvalue == "" {
 		return 0, err
 	}
-	val, err := strconv.ParseFloat(formvalue, 64)
+	val, err := parseFiniteFloat(formvalue)
 	if err != nil {
 		log.Warn(ctx, err)
 		//nolint:err113
@@ -348,6 +460,19 @@ func (irh *ImageReductionHandler) setOptionValueFloat(ctx context.Context, formv
 	return val, err
 }
 
+// parseFiniteFloat parses float parameter rejecting NaN and Inf, which break the size calculation of image.
+func parseFiniteFloat(param string) (float64, error) {
+	val, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		//nolint:err113
+		return 0, fmt.Errorf("not finite number: %s", param)
+	}
+	return val, nil
+}
+
 //nolint:mnd
 func (irh *ImageReductionHandler) getCropParam(ctx context.Context, cropparam string, err error) ([4]int, error) {
 	if err != nil {
@@ -380,3 +505,135 @@ func (irh *ImageReductionHandler) getCropParam(ctx context.Context, cropparam st
 	copy(intcrops[:], intslicecrops[:4])
 	return intcrops, nil
 }
+
+func (irh *ImageReductionHandler) getFormatParam(formatparam, accept string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if formatparam == "" {
+		return "", nil
+	}
+	if formatparam == config.FormValueAuto {
+		return negotiateImageFormat(accept), nil
+	}
+	if !actor.IsSupportedImageFormat(formatparam) {
+		//nolint:err113
+		return "", errors.New("invalid format parameter")
+	}
+	return formatparam, nil
+}
+
+func (irh *ImageReductionHandler) getColorParam(ctx context.Context, colorparam string, err error) (color.NRGBA, error) {
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+	if colorparam == "" {
+		return color.NRGBA{}, nil
+	}
+	col, err := utils.ParseHexColor(colorparam)
+	if err != nil {
+		log.Warn(ctx, err)
+		//nolint:err113
+		return color.NRGBA{}, errors.New("color parameter must be hex like : ffffff or ffffff80")
+	}
+	return col, nil
+}
+
+//nolint:mnd
+func (irh *ImageReductionHandler) getFocalPointParam(ctx context.Context, fpparam string, err error) ([2]float64, error) {
+	if err != nil {
+		return [2]float64{}, err
+	}
+	if fpparam == "" {
+		return [2]float64{}, nil
+	}
+	points := strings.Split(fpparam, ",")
+	if len(points) != 2 {
+		//nolint:err113
+		return [2]float64{}, errors.New("focal point parameters must need two with comma like : 0.3,0.7")
+	}
+	var focalpoint [2]float64
+	for i, point := range points {
+		val, err := parseFiniteFloat(point)
+		if err != nil {
+			log.Warn(ctx, err)
+			//nolint:err113
+			return [2]float64{}, errors.New("invalid focal point parameter")
+		}
+		if val < 0 || val > 1 {
+			//nolint:err113
+			return [2]float64{}, errors.New("focal point parameter must be between 0 and 1")
+		}
+		focalpoint[i] = val
+	}
+	return focalpoint, nil
+}
+
+//nolint:mnd
+func (irh *ImageReductionHandler) getSharpenParam(ctx context.Context, sharpenparam string, err error) ([3]float64, error) {
+	if err != nil {
+		return [3]float64{}, err
+	}
+	if sharpenparam == "" {
+		return [3]float64{}, nil
+	}
+	params := strings.Split(sharpenparam, ",")
+	if len(params) > 3 {
+		//nolint:err113
+		return [3]float64{}, errors.New("sharpen parameters must be amount with optional sigma and threshold like : 1.5,1.0,10")
+	}
+	var sharpen [3]float64
+	for i, param := range params {
+		val, err := parseFiniteFloat(param)
+		if err != nil {
+			log.Warn(ctx, err)
+			//nolint:err113
+			return [3]float64{}, errors.New("invalid sharpen parameter")
+		}
+		if val < 0 {
+			//nolint:err113
+			return [3]float64{}, errors.New("sharpen parameter must not be negative")
+		}
+		sharpen[i] = val
+	}
+	return sharpen, nil
+}
+
+//nolint:mnd
+func (irh *ImageReductionHandler) getColorMatrixParam(ctx context.Context, matrixparam string, err error) ([20]float64, error) {
+	if err != nil {
+		return [20]float64{}, err
+	}
+	if matrixparam == "" {
+		return [20]float64{}, nil
+	}
+	params := strings.Split(matrixparam, ",")
+	if len(params) != 20 {
+		//nolint:err113
+		return [20]float64{}, errors.New("color matrix parameters must be 20 values of 4x5 rgba rows")
+	}
+	var matrix [20]float64
+	for i, param := range params {
+		val, err := parseFiniteFloat(param)
+		if err != nil {
+			log.Warn(ctx, err)
+			//nolint:err113
+			return [20]float64{}, errors.New("invalid color matrix parameter")
+		}
+		matrix[i] = val
+	}
+	return matrix, nil
+}
+
+func (irh *ImageReductionHandler) getWatermarkParam(watermarkparam string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if watermarkparam == "" {
+		return "", nil
+	}
+	if err := validator.NewStorageKeyValidator().Validate(watermarkparam); err != nil {
+		return "", err
+	}
+	return watermarkparam, nil
+}
@@ -165,6 +165,73 @@ func TestImageReductionHandler_Request_WithResize(t *testing.T) { //nolint:paral
 	}
 }
 
+func TestImageReductionHandler_Request_WithFormat(t *testing.T) { //nolint:paralleltest
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	env := setupHandlerEnv(t)
+	ctx := t.Context()
+
+	pngData := createTestPNG(t)
+	if err := env.csa.Put(ctx, "img/format.png", bytes.NewReader(pngData)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	e := echo.New()
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/image?key=img/format.png&fmt=webp", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if err := env.handler.Request(c); err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "image/webp" {
+		t.Fatalf("Content-Type = %q, want image/webp", ct)
+	}
+}
+
+func TestImageReductionHandler_Request_AutoFormat(t *testing.T) { //nolint:paralleltest
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	env := setupHandlerEnv(t)
+	ctx := t.Context()
+
+	pngData := createTestPNG(t)
+	if err := env.csa.Put(ctx, "img/auto.png", bytes.NewReader(pngData)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	e := echo.New()
+	for accept, want := range map[string]string{
+		"image/webp,*/*": "image/webp",
+		"*/*":            "image/png",
+	} {
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/image?key=img/auto.png&fmt=auto", nil)
+		req.Header.Set(echo.HeaderAccept, accept)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if err := env.handler.Request(c); err != nil {
+			t.Fatalf("Request: %v", err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		if ct := rec.Header().Get(echo.HeaderContentType); ct != want {
+			t.Fatalf("Accept %q: Content-Type = %q, want %q", accept, ct, want)
+		}
+		if vary := rec.Header().Get(echo.HeaderVary); vary != echo.HeaderAccept {
+			t.Fatalf("Vary = %q, want Accept", vary)
+		}
+	}
+}
+
 func TestImageReductionHandler_Request_CacheHit(t *testing.T) { //nolint:paralleltest
 	if testing.Short() {
 		t.Skip("skipping integration test in short mode")
@@ -2,6 +2,10 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -9,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/howood/imagereductor/application/actor"
+	"github.com/howood/imagereductor/application/usecase"
 	"github.com/labstack/echo/v5"
 )
 
@@ -71,6 +76,11 @@ func Test_setOptionValueFloat(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for invalid float")
 	}
+	for _, invalid := range []string{"NaN", "Inf", "-Inf", "1e999"} {
+		if _, err = h.setOptionValueFloat(ctx, invalid, nil); err == nil {
+			t.Fatalf("expected error for %q", invalid)
+		}
+	}
 	v, err = h.setOptionValueFloat(ctx, "1.0", errFromString("prev"))
 	if err == nil || v != 0 {
 		t.Fatalf("pre-existing error should propagate")
@@ -110,30 +120,261 @@ func Test_getCropParam(t *testing.T) {
 	}
 }
 
+func Test_getFormatParam(t *testing.T) {
+	t.Parallel()
+
+	h := &ImageReductionHandler{}
+
+	got, err := h.getFormatParam("", "", nil)
+	if err != nil || got != "" {
+		t.Fatalf("empty should return empty; got %q,%v", got, err)
+	}
+	got, err = h.getFormatParam("webp", "", nil)
+	if err != nil || got != actor.ImageFormatWebp {
+		t.Fatalf("expected webp,nil; got %q,%v", got, err)
+	}
+	if _, err = h.getFormatParam("svg", "", nil); err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+	if _, err = h.getFormatParam("png", "", errFromString("prev")); err == nil {
+		t.Fatal("pre-existing error should propagate")
+	}
+	got, err = h.getFormatParam("auto", "image/avif,image/webp,*/*", nil)
+	if err != nil || got != actor.ImageFormatWebp {
+		t.Fatalf("auto with webp accept should return webp; got %q,%v", got, err)
+	}
+	got, err = h.getFormatParam("auto", "image/*,*/*;q=0.8", nil)
+	if err != nil || got != "" {
+		t.Fatalf("auto without webp accept should keep original; got %q,%v", got, err)
+	}
+}
+
+func Test_negotiateImageFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"":                              "",
+		"*/*":                           "",
+		"image/webp":                    "webp",
+		"image/avif, image/webp;q=0.9":  "webp",
+		"image/webp;q=0, image/png":     "",
+		"text/html,image/webp,*/*;q=.8": "webp",
+	}
+	for accept, want := range tests {
+		if got := negotiateImageFormat(accept); got != want {
+			t.Errorf("negotiateImageFormat(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func Test_normalizeCacheKey_AutoFormat(t *testing.T) {
+	t.Parallel()
+
+	c1 := newEchoCtx(http.MethodGet, "/?key=a.jpg&fmt=auto", "")
+	c1.Request().Header.Set(echo.HeaderAccept, "image/webp,*/*")
+	c2 := newEchoCtx(http.MethodGet, "/?fmt=auto&key=a.jpg", "")
+	c2.Request().Header.Set(echo.HeaderAccept, "*/*")
+	if normalizeCacheKey(c1) == normalizeCacheKey(c2) {
+		t.Fatalf("expected negotiated format in cache key, got %q", normalizeCacheKey(c1))
+	}
+	if got := normalizeCacheKey(c1); got != "/?fmt=auto:webp&key=a.jpg" {
+		t.Fatalf("cache key = %q", got)
+	}
+}
+
+func Test_getColorParam(t *testing.T) {
+	t.Parallel()
+
+	h := &ImageReductionHandler{}
+	ctx := context.Background()
+
+	got, err := h.getColorParam(ctx, "", nil)
+	if err != nil || got != (color.NRGBA{}) {
+		t.Fatalf("empty should return zero; got %v,%v", got, err)
+	}
+	got, err = h.getColorParam(ctx, "ffffff", nil)
+	if err != nil || got != (color.NRGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Fatalf("expected white,nil; got %v,%v", got, err)
+	}
+	if _, err = h.getColorParam(ctx, "white", nil); err == nil {
+		t.Fatal("expected error for invalid color")
+	}
+	if _, err = h.getColorParam(ctx, "ffffff", errFromString("prev")); err == nil {
+		t.Fatal("pre-existing error should propagate")
+	}
+}
+
+func Test_getFocalPointParam(t *testing.T) {
+	t.Parallel()
+
+	h := &ImageReductionHandler{}
+	ctx := context.Background()
+
+	got, err := h.getFocalPointParam(ctx, "", nil)
+	if err != nil || got != ([2]float64{}) {
+		t.Fatalf("empty should return zero; got %v,%v", got, err)
+	}
+	got, err = h.getFocalPointParam(ctx, "0.3,0.7", nil)
+	if err != nil || got != ([2]float64{0.3, 0.7}) {
+		t.Fatalf("expected [0.3,0.7],nil; got %v,%v", got, err)
+	}
+	for _, invalid := range []string{"0.3", "0.3,bad", "0.3,1.5", "-0.1,0.5"} {
+		if _, err = h.getFocalPointParam(ctx, invalid, nil); err == nil {
+			t.Fatalf("expected error for %q", invalid)
+		}
+	}
+	if _, err = h.getFocalPointParam(ctx, "0.3,0.7", errFromString("prev")); err == nil {
+		t.Fatal("pre-existing error should propagate")
+	}
+}
+
+func Test_getSharpenParam(t *testing.T) {
+	t.Parallel()
+
+	h := &ImageReductionHandler{}
+	ctx := context.Background()
+
+	got, err := h.getSharpenParam(ctx, "", nil)
+	if err != nil || got != ([3]float64{}) {
+		t.Fatalf("empty should return zero; got %v,%v", got, err)
+	}
+	got, err = h.getSharpenParam(ctx, "1.5", nil)
+	if err != nil || got != ([3]float64{1.5, 0, 0}) {
+		t.Fatalf("expected [1.5,0,0],nil; got %v,%v", got, err)
+	}
+	got, err = h.getSharpenParam(ctx, "1.5,2,10", nil)
+	if err != nil || got != ([3]float64{1.5, 2, 10}) {
+		t.Fatalf("expected [1.5,2,10],nil; got %v,%v", got, err)
+	}
+	for _, invalid := range []string{"1,2,3,4", "bad", "1,-2", "NaN", "1,Inf"} {
+		if _, err = h.getSharpenParam(ctx, invalid, nil); err == nil {
+			t.Fatalf("expected error for %q", invalid)
+		}
+	}
+	if _, err = h.getSharpenParam(ctx, "1", errFromString("prev")); err == nil {
+		t.Fatal("pre-existing error should propagate")
+	}
+}
+
+func Test_getColorMatrixParam(t *testing.T) {
+	t.Parallel()
+
+	h := &ImageReductionHandler{}
+	ctx := context.Background()
+
+	got, err := h.getColorMatrixParam(ctx, "", nil)
+	if err != nil || got != ([20]float64{}) {
+		t.Fatalf("empty should return zero; got %v,%v", got, err)
+	}
+	got, err = h.getColorMatrixParam(ctx, "1,0,0,0,0,0,1,0,0,0,0,0,1,0,0,0,0,0,1,0.1", nil)
+	if err != nil || got != ([20]float64{1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0.1}) {
+		t.Fatalf("unexpected matrix; got %v,%v", got, err)
+	}
+	for _, invalid := range []string{"1,0,0,0", "1,0,0,0,0,0,1,0,0,0,0,0,1,0,0,0,0,0,1,bad"} {
+		if _, err = h.getColorMatrixParam(ctx, invalid, nil); err == nil {
+			t.Fatalf("expected error for %q", invalid)
+		}
+	}
+	if _, err = h.getColorMatrixParam(ctx, "", errFromString("prev")); err == nil {
+		t.Fatal("pre-existing error should propagate")
+	}
+}
+
+func Test_getWatermarkParam(t *testing.T) {
+	t.Parallel()
+
+	h := &ImageReductionHandler{}
+
+	got, err := h.getWatermarkParam("", nil)
+	if err != nil || got != "" {
+		t.Fatalf("empty should return empty; got %q,%v", got, err)
+	}
+	got, err = h.getWatermarkParam("logo/mark.png", nil)
+	if err != nil || got != "logo/mark.png" {
+		t.Fatalf("expected logo/mark.png,nil; got %q,%v", got, err)
+	}
+	if _, err = h.getWatermarkParam("../secret.png", nil); err == nil {
+		t.Fatal("expected error for path traversal")
+	}
+	if _, err = h.getWatermarkParam("logo/mark.png", errFromString("prev")); err == nil {
+		t.Fatal("pre-existing error should propagate")
+	}
+}
+
 func Test_getImageOptionByFormValue(t *testing.T) {
 	t.Parallel()
 
 	h := &ImageReductionHandler{}
-	c := newEchoCtx(http.MethodPost, "/", "w=100&h=200&q=3&rotate=right&bri=10&cont=20&gam=2.2&crop=1,2,3,4")
+	c := newEchoCtx(http.MethodPost, "/", "w=100&h=200&dpr=2&enlarge=true&q=3&rotate=right&flip=hv&radius=max&trim=12&bri=10&cont=20&gam=2.2&crop=1,2,3,4&lossless=true&fmt=jpeg&fit=cover&bg=ff000080&gravity=ne&fp=0.25,0.75&frame=2&compression=none&blur=1.5&sharpen=0.8,2&grayscale=true&sepia=50&sat=-20&hue=90&invert=true&matrix=1,0,0,0,0,0,1,0,0,0,0,0,1,0,0,0,0,0,0.5,0&wm=logo/mark.png&wmpos=nw&wmmargin=8&wmopacity=60&wmscale=0.2&text=SOLD&font=gobold&textsize=32&textcolor=ffffff&textstroke=2&textstrokecolor=000000&textpos=s&textmargin=4&textbg=00000080")
 	opt, err := h.getImageOptionByFormValue(context.Background(), c)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	want := actor.ImageOperatorOption{
-		Width:      100,
-		Height:     200,
-		Quality:    3,
-		Rotate:     "right",
-		Brightness: 10,
-		Contrast:   20,
-		Gamma:      2.2,
-		Crop:       [4]int{1, 2, 3, 4},
+		Width:             100,
+		Height:            200,
+		Dpr:               2,
+		Enlarge:           true,
+		Quality:           3,
+		Rotate:            "right",
+		Flip:              "hv",
+		Radius:            "max",
+		Trim:              12,
+		Brightness:        10,
+		Contrast:          20,
+		Gamma:             2.2,
+		Crop:              [4]int{1, 2, 3, 4},
+		Lossless:          true,
+		Format:            "jpeg",
+		Fit:               "cover",
+		Background:        color.NRGBA{R: 255, A: 128},
+		Gravity:           "focalpoint",
+		FocalPoint:        [2]float64{0.25, 0.75},
+		Frame:             2,
+		Compression:       "none",
+		Blur:              1.5,
+		Sharpen:           [3]float64{0.8, 2, 0},
+		Grayscale:         true,
+		Sepia:             50,
+		Saturation:        -20,
+		HueRotate:         90,
+		Invert:            true,
+		ColorMatrix:       [20]float64{1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0.5, 0},
+		Watermark:         "logo/mark.png",
+		WatermarkPosition: "nw",
+		WatermarkMargin:   8,
+		WatermarkOpacity:  60,
+		WatermarkScale:    0.2,
+		Text:              "SOLD",
+		TextFont:          "gobold",
+		TextSize:          32,
+		TextColor:         color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+		TextStroke:        2,
+		TextStrokeColor:   color.NRGBA{A: 255},
+		TextPosition:      "s",
+		TextMargin:        4,
+		TextBackground:    color.NRGBA{A: 128},
 	}
 	if !reflect.DeepEqual(opt, want) {
 		t.Fatalf("opt = %#v, want %#v", opt, want)
 	}
 }
 
+func Test_getImageOptionByFormValue_AutoFormat(t *testing.T) {
+	t.Parallel()
+
+	h := &ImageReductionHandler{}
+	c := newEchoCtx(http.MethodGet, "/?key=a.jpg&fmt=auto", "")
+	c.Request().Header.Set(echo.HeaderAccept, "image/webp,*/*")
+	opt, err := h.getImageOptionByFormValue(context.Background(), c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opt.Format != actor.ImageFormatWebp || !opt.AutoFormat {
+		t.Fatalf("expected auto negotiated webp; got %q,%v", opt.Format, opt.AutoFormat)
+	}
+}
+
 func Test_getImageOptionByFormValue_InvalidWidth(t *testing.T) {
 	t.Parallel()
 
@@ -152,3 +393,44 @@ func errFromString(s string) error {
 type simpleError struct{ msg string }
 
 func (e *simpleError) Error() string { return e.msg }
+
+func Test_imageHeaders(t *testing.T) {
+	t.Parallel()
+
+	irh := &ImageReductionHandler{}
+	if got := irh.imageHeaders(actor.ImageOperatorOption{}, image.Rectangle{}); got != nil {
+		t.Fatalf("expected no headers without trim, got %v", got)
+	}
+	got := irh.imageHeaders(actor.ImageOperatorOption{Trim: 10}, image.Rect(10, 5, 40, 25))
+	if !reflect.DeepEqual(got, map[string]string{HeaderTrimBox: "10,5,30,20"}) {
+		t.Fatalf("headers = %v", got)
+	}
+}
+
+func Test_processingErrorResponse(t *testing.T) {
+	t.Parallel()
+
+	irh := &ImageReductionHandler{}
+	tests := map[string]struct {
+		err        error
+		status     int
+		retryAfter string
+	}{
+		"busy":    {fmt.Errorf("%w: queue limit 1 exceeded", usecase.ErrProcessingBusy), http.StatusServiceUnavailable, "1"},
+		"panic":   {fmt.Errorf("%w: runtime error", usecase.ErrProcessingPanic), http.StatusInternalServerError, ""},
+		"invalid": {errors.New("invalid Fit Parameter"), http.StatusBadRequest, ""},
+	}
+	for name, tt := range tests {
+		c := newEchoCtx(http.MethodGet, "/", "")
+		if err := irh.processingErrorResponse(context.Background(), c, tt.err); err != nil {
+			t.Fatalf("%s: unexpected: %v", name, err)
+		}
+		rec, _ := echo.UnwrapResponse(c.Response())
+		if rec.Status != tt.status {
+			t.Errorf("%s: status = %d, want %d", name, rec.Status, tt.status)
+		}
+		if got := c.Response().Header().Get(echo.HeaderRetryAfter); got != tt.retryAfter {
+			t.Errorf("%s: Retry-After = %q, want %q", name, got, tt.retryAfter)
+		}
+	}
+}
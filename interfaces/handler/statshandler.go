@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	log "github.com/howood/imagereductor/infrastructure/logger"
+	"github.com/howood/imagereductor/infrastructure/requestid"
+	"github.com/labstack/echo/v5"
+)
+
+// StatsHandler struct.
+type StatsHandler struct {
+	BaseHandler
+}
+
+func NewStatsHandler(baseHandler BaseHandler) *StatsHandler {
+	return &StatsHandler{BaseHandler: baseHandler}
+}
+
+// Request is get running and waiting count of image processing and cache counters for monitoring.
+func (sh *StatsHandler) Request(c *echo.Context) error {
+	xRequestID := requestid.GetRequestID(c.Request())
+	ctx := context.WithValue(c.Request().Context(), requestid.GetRequestIDKey(), xRequestID)
+	log.Debug(ctx, "========= START REQUEST : "+c.Request().URL.RequestURI())
+	stats := map[string]any{"processing": sh.UcCluster.ImageUC.ProcessingStats()}
+	if cachestats, ok := sh.UcCluster.CacheUC.CacheStats(); ok {
+		stats["cache"] = cachestats
+	}
+	return c.JSONPretty(http.StatusOK, stats, marshalIndent)
+}
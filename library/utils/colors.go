@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"encoding/hex"
+	"errors"
+	"image/color"
+)
+
+// ErrInvalidHexColor is returned when hex color is not RRGGBB or RRGGBBAA.
+var ErrInvalidHexColor = errors.New("invalid hex color")
+
+// ParseHexColor parses RRGGBB or RRGGBBAA to color.
+func ParseHexColor(hexcolor string) (color.NRGBA, error) {
+	//nolint:mnd
+	if len(hexcolor) != 6 && len(hexcolor) != 8 {
+		return color.NRGBA{}, ErrInvalidHexColor
+	}
+	decoded, err := hex.DecodeString(hexcolor)
+	if err != nil {
+		return color.NRGBA{}, ErrInvalidHexColor
+	}
+	col := color.NRGBA{R: decoded[0], G: decoded[1], B: decoded[2], A: 0xff}
+	//nolint:mnd
+	if len(decoded) == 4 {
+		col.A = decoded[3]
+	}
+	return col, nil
+}
@@ -0,0 +1,39 @@
+package utils_test
+
+import (
+	"errors"
+	"image/color"
+	"testing"
+
+	"github.com/howood/imagereductor/library/utils"
+)
+
+func Test_ParseHexColor(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		input    string
+		expected color.NRGBA
+		err      error
+	}{
+		{"ffffff", color.NRGBA{R: 255, G: 255, B: 255, A: 255}, nil},
+		{"102030", color.NRGBA{R: 16, G: 32, B: 48, A: 255}, nil},
+		{"10203080", color.NRGBA{R: 16, G: 32, B: 48, A: 128}, nil},
+		{"FFaa00", color.NRGBA{R: 255, G: 170, B: 0, A: 255}, nil},
+		{"fff", color.NRGBA{}, utils.ErrInvalidHexColor},
+		{"gggggg", color.NRGBA{}, utils.ErrInvalidHexColor},
+		{"", color.NRGBA{}, utils.ErrInvalidHexColor},
+	}
+	for _, tc := range cases {
+		t.Run(tc.input, func(t *testing.T) {
+			t.Parallel()
+			got, err := utils.ParseHexColor(tc.input)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("ParseHexColor(%q) error = %v, want %v", tc.input, err, tc.err)
+			}
+			if got != tc.expected {
+				t.Fatalf("ParseHexColor(%q) = %v, want %v", tc.input, got, tc.expected)
+			}
+		})
+	}
+}
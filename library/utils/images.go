@@ -4,9 +4,14 @@ import (
 	"errors"
 	"io"
 	"net/http"
+
+	extramimetype "github.com/gabriel-vasile/mimetype"
 )
 
+const mimeOctetStream = "application/octet-stream"
+
 // GetContentTypeByReadSeeker is get content type by Readseeker.
+// Types http.DetectContentType does not know such as tiff are detected by mimetype.
 func GetContentTypeByReadSeeker(reader io.ReadSeeker) (string, error) {
 	_, err := reader.Seek(0, io.SeekStart)
 	if err != nil {
@@ -17,5 +22,9 @@ func GetContentTypeByReadSeeker(reader io.ReadSeeker) (string, error) {
 	if err != nil && !errors.Is(err, io.EOF) {
 		return "", err
 	}
-	return http.DetectContentType(buf[:n]), nil
+	contentType := http.DetectContentType(buf[:n])
+	if contentType == mimeOctetStream {
+		contentType = extramimetype.Detect(buf[:n]).String()
+	}
+	return contentType, nil
 }
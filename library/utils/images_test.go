@@ -74,3 +74,17 @@ func (f *failSeekReader) Read(_ []byte) (int, error) {
 func (f *failSeekReader) Seek(_ int64, _ int) (int64, error) {
 	return 0, errSeekFailed
 }
+
+func Test_GetContentTypeByReadSeeker_TIFF(t *testing.T) {
+	t.Parallel()
+
+	// little endian TIFF header is not known by http.DetectContentType
+	tiffHeader := []byte{0x49, 0x49, 0x2A, 0x00, 0x08, 0x00, 0x00, 0x00}
+	ct, err := utils.GetContentTypeByReadSeeker(bytes.NewReader(tiffHeader))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ct != "image/tiff" {
+		t.Fatalf("expected image/tiff, got %q", ct)
+	}
+}